@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/tomasen/realip"
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+	"kyawzayarwin.com/greenlight/internal/rotate"
+)
+
+// accessLogger writes a line per request, as JSON through jsonlog or in the Apache
+// combined log format.
+type accessLogger struct {
+	format string
+	out    io.Writer
+	json   *jsonlog.Logger
+	closer io.Closer
+}
+
+// newAccessLogger returns the access log set up by the -access-log-* flags, or nil
+// when it's off.
+func newAccessLogger(cfg config) (*accessLogger, error) {
+	a := &accessLogger{format: cfg.accessLog.format}
+
+	switch cfg.accessLog.output {
+	case "", "off":
+		return nil, nil
+	case "stdout":
+		a.out = os.Stdout
+	default:
+		w, err := rotate.Open(cfg.accessLog.output, rotate.Options{
+			MaxSize:    cfg.accessLog.maxSize * 1024 * 1024,
+			Interval:   cfg.accessLog.rotateEvery,
+			MaxBackups: cfg.accessLog.maxBackups,
+			MaxAge:     cfg.accessLog.maxAge,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		a.out, a.closer = w, w
+	}
+
+	switch a.format {
+	case "json":
+		a.json = jsonlog.New(a.out, jsonlog.LevelInfo)
+		a.json.SetStackLevel(jsonlog.LevelOff)
+	case "combined":
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", a.format)
+	}
+
+	return a, nil
+}
+
+func (a *accessLogger) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+
+	return a.closer.Close()
+}
+
+// accessLogEntry is what's logged about a request.
+type accessLogEntry struct {
+	start     time.Time
+	method    string
+	uri       string
+	proto     string
+	route     string
+	status    int
+	bytes     int64
+	duration  time.Duration
+	clientIP  string
+	userID    int64
+	userAgent string
+	referer   string
+	requestID string
+}
+
+func (a *accessLogger) log(e accessLogEntry) {
+	if a.format == "combined" {
+		a.out.Write([]byte(e.combined()))
+		return
+	}
+
+	properties := map[string]any{
+		"method":      e.method,
+		"uri":         e.uri,
+		"route":       e.route,
+		"status":      e.status,
+		"bytes":       e.bytes,
+		"duration_ms": float64(e.duration.Microseconds()) / 1000,
+		"client_ip":   e.clientIP,
+		"user_agent":  e.userAgent,
+		"request_id":  e.requestID,
+	}
+
+	if e.userID != 0 {
+		properties["user_id"] = e.userID
+	}
+
+	if e.referer != "" {
+		properties["referer"] = e.referer
+	}
+
+	a.json.PrintInfo("request", properties)
+}
+
+// combined formats the entry in the Apache combined log format, with the user ID
+// as the user:
+//
+//	203.0.113.7 - 42 [18/Oct/2026:21:38:07 +0000] "GET /v1/movies HTTP/1.1" 200 1234 "-" "curl/8.5.0"
+func (e accessLogEntry) combined() string {
+	user := "-"
+
+	if e.userID != 0 {
+		user = strconv.FormatInt(e.userID, 10)
+	}
+
+	size := "-"
+
+	if e.bytes > 0 {
+		size = strconv.FormatInt(e.bytes, 10)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		orDash(e.clientIP), user, e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.method, escapeCombined(e.uri), e.proto, e.status, size,
+		escapeCombined(orDash(e.referer)), escapeCombined(orDash(e.userAgent)))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// escapeCombined escapes quotes, backslashes and control characters, so that a
+// client can't break a line in two or out of its quotes.
+func escapeCombined(s string) string {
+	var b strings.Builder
+
+	for _, c := range []byte(s) {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// accessLog writes a line to the access log for every request.
+func (app *application) accessLog(next http.Handler) http.Handler {
+	if app.access == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+
+		entry := accessLogEntry{
+			start:     start,
+			method:    r.Method,
+			uri:       r.URL.RequestURI(),
+			proto:     r.Proto,
+			route:     "unmatched",
+			status:    metrics.Code,
+			bytes:     metrics.Written,
+			duration:  metrics.Duration,
+			clientIP:  realip.FromRequest(r),
+			userAgent: r.UserAgent(),
+			referer:   r.Referer(),
+			requestID: app.ContextGetRequestID(r),
+		}
+
+		if info := app.ContextGetRequestInfo(r); info != nil {
+			entry.route = routeLabel(info.pattern)
+			entry.userID = info.userID
+		}
+
+		app.access.log(entry)
+	})
+}
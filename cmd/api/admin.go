@@ -0,0 +1,180 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rtdebug "runtime/debug"
+	rtpprof "runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+// adminRoutes are served by the admin listener, which is meant to be reachable
+// from the host or the private network only. The Prometheus metrics are open to
+// scrapers there, while the debug endpoints also need a user with the admin:debug
+// permission, and every use of them is audit-logged.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /metrics", app.recordRoute(app.prom.registry.Handler()))
+
+	// The audit log sits outside authenticate, so that requests with an invalid
+	// token are logged too.
+	debug := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, app.recordRoute(app.auditDebug(app.authenticate(app.requirePermission(data.PermissionAdminDebug, handler)))))
+	}
+
+	debug("GET /debug/vars", expvar.Handler())
+
+	debug("GET /debug/pprof/", http.HandlerFunc(pprof.Index))
+	debug("GET /debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	debug("GET /debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	debug("GET /debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	debug("POST /debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	debug("GET /debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+
+	debug("GET /debug/goroutines", http.HandlerFunc(app.goroutinesHandler))
+	debug("POST /debug/gc", http.HandlerFunc(app.gcHandler))
+	debug("GET /debug/log-level", http.HandlerFunc(app.showLogLevelHandler))
+	debug("PUT /debug/log-level", http.HandlerFunc(app.updateLogLevelHandler))
+
+	adminMiddleware := CreateMiddlewareStack(
+		app.requestID,
+		app.recoverPanic,
+	)
+
+	return adminMiddleware(mux)
+}
+
+// auditDebug records every request to a debug endpoint in the audit log, allowed
+// or not. It runs outside authenticate, so the user ID, when there is one, comes
+// with the request's log properties. Handlers can add to the event's details.
+func (app *application) auditDebug(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		details := map[string]string{
+			"method":   r.Method,
+			"endpoint": r.URL.RequestURI(),
+		}
+
+		metrics := httpsnoop.CaptureMetrics(next, w, app.ContextSetAuditDetails(r, details))
+
+		outcome := data.AuditSuccess
+
+		if metrics.Code >= 400 {
+			outcome = data.AuditFailure
+		}
+
+		details["status"] = strconv.Itoa(metrics.Code)
+
+		userID, _ := jsonlog.ContextProperties(r.Context())["user_id"].(int64)
+
+		app.recordAuditEvent(r, data.AuditEvent{
+			Action:  data.AuditDebugAccessed,
+			Outcome: outcome,
+			ActorID: userID,
+			Details: details,
+		})
+	})
+}
+
+// goroutinesHandler dumps the stacks of all goroutines, in the format of an
+// unrecovered panic.
+func (app *application) goroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := rtpprof.Lookup("goroutine").WriteTo(w, 2)
+
+	if err != nil {
+		app.logError(err, r)
+	}
+}
+
+// gcHandler runs a garbage collection and returns memory to the operating system,
+// reporting the heap before and after.
+func (app *application) gcHandler(w http.ResponseWriter, r *http.Request) {
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+
+	rtdebug.FreeOSMemory()
+
+	duration := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	data := envelope{
+		"heap_alloc_before": before.HeapAlloc,
+		"heap_alloc_after":  after.HeapAlloc,
+		"heap_sys_before":   before.HeapSys - before.HeapReleased,
+		"heap_sys_after":    after.HeapSys - after.HeapReleased,
+		"duration":          duration.String(),
+	}
+
+	err := app.render(w, r, http.StatusOK, data)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.render(w, r, http.StatusOK, envelope{"level": app.logger.Level()})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateLogLevelHandler changes the minimum level of the application log until the
+// next restart, like to debug an issue in production without redeploying.
+func (app *application) updateLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Level string `json:"level"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	level, err := jsonlog.ParseLevel(input.Level)
+
+	v.Check(input.Level != "", "level", "must be provided")
+	v.Check(input.Level == "" || err == nil, "level", "must be one of debug, info, warn, error, fatal or off")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	previous := app.logger.Level()
+
+	app.logger.SetLevel(level)
+
+	// The change is recorded in the audit log, along with the request, by
+	// auditDebug.
+	if details := app.ContextGetAuditDetails(r); details != nil {
+		details["log_level_from"] = previous.String()
+		details["log_level_to"] = level.String()
+	}
+
+	err = app.render(w, r, http.StatusOK, envelope{"level": level})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
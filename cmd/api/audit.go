@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/tomasen/realip"
+	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+// auditEvent fills in who made the request and where it came from. The actor is
+// the authenticated user unless the event says otherwise.
+func (app *application) auditEvent(r *http.Request, event data.AuditEvent) data.AuditEvent {
+	// Requests outside authenticate, like those to the debug endpoints, have no
+	// user in their context.
+	if user, ok := r.Context().Value(userContextKey).(*data.User); ok && event.ActorID == 0 && !user.IsAnonymous() {
+		event.ActorID = user.ID
+	}
+
+	event.IP = realip.FromRequest(r)
+	event.UserAgent = r.UserAgent()
+	event.RequestID = app.ContextGetRequestID(r)
+
+	return event
+}
+
+// recordAuditEvent appends a security event to the audit log, with where the
+// request came from. Failing to record the event is logged but doesn't fail the
+// request.
+func (app *application) recordAuditEvent(r *http.Request, event data.AuditEvent) {
+	event = app.auditEvent(r, event)
+
+	// The event is recorded even if the client has gone away.
+	err := app.models.Audit.Insert(context.WithoutCancel(r.Context()), &event)
+
+	if err != nil {
+		app.logger.PrintErrorContext(r.Context(), err, map[string]any{
+			"audit_action":  event.Action,
+			"audit_outcome": event.Outcome,
+		})
+	}
+}
+
+func (app *application) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.AuditQuery
+		data.Filters
+	}
+
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	input.Action = app.readString(qs, "action", "")
+	input.Outcome = app.readString(qs, "outcome", "")
+	input.ActorID = int64(app.readInt(qs, "actor_id", 0, v))
+	input.SubjectID = int64(app.readInt(qs, "subject_id", 0, v))
+	input.IP = app.readString(qs, "ip", "")
+	input.Since = app.readTime(qs, "since", time.Time{}, v)
+	input.Until = app.readTime(qs, "until", time.Time{}, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+	input.Filters.SortSafelist = []string{"id", "-id"}
+
+	data.ValidateFilter(v, input.Filters)
+	data.ValidateAuditQuery(v, input.AuditQuery)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(r.Context(), input.AuditQuery, input.Filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render(w, r, http.StatusOK, envelope{"events": events, "metadata": metadata})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyAuditEventsHandler checks the hash chain of the audit log, to find out
+// whether events were changed or removed behind the application's back.
+func (app *application) verifyAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	verification, err := app.models.Audit.Verify(r.Context())
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !verification.Valid {
+		app.logger.PrintWarnContext(r.Context(), "audit log hash chain is broken", map[string]any{
+			"first_invalid_id": verification.FirstInvalidID,
+		})
+	}
+
+	err = app.render(w, r, http.StatusOK, envelope{"verification": verification})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
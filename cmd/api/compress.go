@@ -0,0 +1,267 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}}
+)
+
+// compressWriter buffers the start of a response until it knows whether it's worth
+// compressing: the body has to reach the minimum size and the content type has to
+// be in the allowlist. A flush decides early, so streamed responses start flowing
+// right away and are compressed chunk by chunk.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding     string
+	minSize      int
+	contentTypes []string
+
+	status     int
+	buf        []byte
+	decided    bool
+	compressor interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	// Informational responses go straight through, and once the headers are out
+	// the underlying writer deals with any superfluous calls.
+	if cw.decided || status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if cw.status != 0 {
+		return
+	}
+
+	cw.status = status
+
+	// Responses without a body never get compressed.
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+
+		if len(cw.buf) >= cw.minSize {
+			cw.decide(cw.compressible())
+		}
+
+		return len(b), nil
+	}
+
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// compressible reports whether the response may be compressed, ignoring its size.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+
+	if contentType == "" {
+		contentType = http.DetectContentType(cw.buf)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range cw.contentTypes {
+		if mediaType == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decide sends the headers, compressed or not, along with anything buffered so far.
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		switch cw.encoding {
+		case "gzip":
+			gz := gzipWriters.Get().(*gzip.Writer)
+			gz.Reset(cw.ResponseWriter)
+			cw.compressor = gz
+		case "deflate":
+			fw := flateWriters.Get().(*flate.Writer)
+			fw.Reset(cw.ResponseWriter)
+			cw.compressor = fw
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) > 0 {
+		if cw.compressor != nil {
+			cw.compressor.Write(cw.buf)
+		} else {
+			cw.ResponseWriter.Write(cw.buf)
+		}
+	}
+
+	cw.buf = nil
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		// A handler that flushes is streaming, so the rest of the body is expected
+		// to follow and only the content type counts.
+		cw.decide(cw.compressible())
+	}
+
+	if cw.compressor != nil {
+		cw.compressor.Flush()
+	}
+
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// close finishes the response, compressing it only when it turned out big enough.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if len(cw.buf) == 0 && cw.status == 0 {
+			return
+		}
+
+		cw.decide(len(cw.buf) >= cw.minSize && cw.compressible())
+	}
+
+	if cw.compressor == nil {
+		return
+	}
+
+	cw.compressor.Close()
+
+	switch c := cw.compressor.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(c)
+	case *flate.Writer:
+		flateWriters.Put(c)
+	}
+
+	cw.compressor = nil
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header, preferring
+// gzip. It returns an empty string when neither is acceptable.
+func acceptedEncoding(header string) string {
+	qualities := map[string]float64{}
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		qualities[strings.ToLower(strings.TrimSpace(coding))] = q
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, ok := qualities[encoding]
+
+		if !ok {
+			q, ok = qualities["*"]
+		}
+
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compress compresses responses with gzip or deflate when the client accepts it.
+// It wraps the ResponseWriter, so it has to run inside the metrics middleware for
+// httpsnoop to keep capturing the status code, and the byte count it reports is
+// the number of compressed bytes sent.
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.compression.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The response depends on Accept-Encoding whether or not this one ends up
+		// compressed.
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        app.config.compression.minSize,
+			contentTypes:   app.config.compression.contentTypes,
+		}
+
+		next.ServeHTTP(cw, r)
+
+		cw.close()
+	})
+}
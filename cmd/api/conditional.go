@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+)
+
+// movieETag derives an entity tag from the movie's version, which is bumped on every
+// update. The tag is weak, as the same version is sent in several representations:
+// compressed or not, in every format, with selected fields and in every API
+// version.
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`W/"%d-%d"`, movie.ID, movie.Version)
+}
+
+// setMovieValidators writes the ETag and Last-Modified headers for the movie.
+func setMovieValidators(w http.ResponseWriter, movie *data.Movie) {
+	w.Header().Set("ETag", movieETag(movie))
+
+	if !movie.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", movie.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// etagListMatches reports whether etag is in a comma separated If-Match or
+// If-None-Match header value, ignoring W/ prefixes. Movie tags are weak, and the
+// strong comparison RFC 9110 asks of If-Match would never match them; as a tag
+// stands for a version of the movie, not its bytes, matching it is what a write
+// precondition needs.
+func etagListMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified reports whether a GET for the movie can be answered with 304 Not
+// Modified. If-None-Match takes precedence over If-Modified-Since.
+func notModified(r *http.Request, movie *data.Movie) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListMatches(inm, movieETag(movie))
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !movie.UpdatedAt.IsZero() {
+		t, err := http.ParseTime(ims)
+
+		if err != nil {
+			return false
+		}
+
+		return !movie.UpdatedAt.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition of a write to the movie. It sends
+// a 412 when the header doesn't match the current version, or a 428 when the header
+// is missing and the server is configured to require it. It reports whether the
+// write may go ahead.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	im := r.Header.Get("If-Match")
+
+	if im == "" {
+		if app.config.preconditions.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	if !etagListMatches(im, movieETag(movie)) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	return true
+}
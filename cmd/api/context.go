@@ -5,11 +5,21 @@ import (
 	"net/http"
 
 	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+	"kyawzayarwin.com/greenlight/internal/render"
 )
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey      = contextKey("user")
+	formatContextKey    = contextKey("format")
+	versionContextKey   = contextKey("version")
+	infoContextKey      = contextKey("info")
+	requestIDContextKey = contextKey("request_id")
+	queriesContextKey   = contextKey("queries")
+	auditContextKey     = contextKey("audit")
+)
 
 func (app *application) ContextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -25,3 +35,98 @@ func (app *application) ContextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *application) ContextSetFormat(r *http.Request, format render.Format) *http.Request {
+	ctx := context.WithValue(r.Context(), formatContextKey, format)
+	return r.WithContext(ctx)
+}
+
+// ContextGetFormat returns the negotiated response format. Responses sent before
+// negotiation, or after it failed, fall back to JSON.
+func (app *application) ContextGetFormat(r *http.Request) render.Format {
+	format, ok := r.Context().Value(formatContextKey).(render.Format)
+
+	if !ok {
+		return render.JSON
+	}
+
+	return format
+}
+
+func (app *application) ContextSetVersion(r *http.Request, version apiVersion) *http.Request {
+	ctx := context.WithValue(r.Context(), versionContextKey, version)
+	return r.WithContext(ctx)
+}
+
+// ContextGetVersion returns the API version of the request. Requests outside the
+// versioned routes get v1.
+func (app *application) ContextGetVersion(r *http.Request) apiVersion {
+	version, ok := r.Context().Value(versionContextKey).(apiVersion)
+
+	if !ok {
+		return apiV1
+	}
+
+	return version
+}
+
+// requestInfo collects what the handlers learn about a request for the middleware
+// around the router. The middleware in between hands the router copies of the
+// request, so fields the router sets, like Pattern, never reach the outer request.
+type requestInfo struct {
+	pattern string
+	// userID is the authenticated user, or 0.
+	userID int64
+}
+
+func (app *application) ContextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), infoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+// ContextGetRequestInfo returns the request's info, or nil outside the metrics
+// middleware.
+func (app *application) ContextGetRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(infoContextKey).(*requestInfo)
+	return info
+}
+
+// ContextSetRequestID stores the request ID, and starts the log properties of the
+// request with it.
+func (app *application) ContextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := jsonlog.NewContext(context.WithValue(r.Context(), requestIDContextKey, id))
+	jsonlog.SetProperty(ctx, "request_id", id)
+	return r.WithContext(ctx)
+}
+
+// ContextGetRequestID returns the request ID, or an empty string outside the
+// requestID middleware.
+func (app *application) ContextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+func (app *application) ContextSetQueryCounts(r *http.Request, counts *queryCounts) *http.Request {
+	ctx := context.WithValue(r.Context(), queriesContextKey, counts)
+	return r.WithContext(ctx)
+}
+
+// contextGetQueryCounts returns the query counts of the request ctx belongs to, or
+// nil when queries aren't counted. It takes a context rather than a request, as it's
+// called from the models' query hook.
+func contextGetQueryCounts(ctx context.Context) *queryCounts {
+	counts, _ := ctx.Value(queriesContextKey).(*queryCounts)
+	return counts
+}
+
+func (app *application) ContextSetAuditDetails(r *http.Request, details map[string]string) *http.Request {
+	ctx := context.WithValue(r.Context(), auditContextKey, details)
+	return r.WithContext(ctx)
+}
+
+// ContextGetAuditDetails returns the details of the audit event recorded for the
+// request, which handlers can add to, or nil when no event is recorded for it.
+func (app *application) ContextGetAuditDetails(r *http.Request) map[string]string {
+	details, _ := r.Context().Value(auditContextKey).(map[string]string)
+	return details
+}
@@ -1,20 +1,35 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/render"
 )
 
 func (app *application) logError(err error, r *http.Request) {
-	app.logger.PrintError(err, map[string]string{
+	app.logger.PrintErrorContext(r.Context(), err, map[string]any{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	// Errors aren't rows, so CSV clients get them as JSON.
+	if app.ContextGetFormat(r).Name == render.CSV.Name {
+		r = app.ContextSetFormat(r, render.JSON)
+	}
+
 	env := envelope{"error": message}
 
-	err := app.writeJSON(w, status, env)
+	// The request ID lets a client point us at the logs of a failed request.
+	if id := app.ContextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
+
+	err := app.render(w, r, status, env)
 
 	if err != nil {
 		app.logError(err, r)
@@ -24,6 +39,7 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(err, r)
+	app.reportError(r.Context(), err, r)
 
 	msg := "the server encountered a problem and could not process your request"
 
@@ -39,7 +55,7 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err)
+	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
@@ -75,6 +91,43 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:  data.AuditAccessDenied,
+		Outcome: data.AuditFailure,
+		Details: map[string]string{"method": r.Method, "path": r.URL.Path},
+	})
+
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be made conditional with an If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
+func (app *application) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this idempotency key is still being processed, please try again later"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this idempotency key has already been used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	formats := []string{}
+
+	for _, f := range render.Formats {
+		formats = append(formats, f.ContentType)
+	}
+
+	message := fmt.Sprintf("the requested response format is not supported, must be one of %s (text/csv for lists only)", strings.Join(formats, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/tomasen/realip"
+	"kyawzayarwin.com/greenlight/internal/errreport"
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+)
+
+// newErrorReporter returns the reporter set up by the -error-report-* flags, or
+// nil when there's no DSN to report to.
+func newErrorReporter(cfg config, logger *jsonlog.Logger) (*errreport.Reporter, error) {
+	if cfg.errorReport.dsn == "" {
+		return nil, nil
+	}
+
+	transport, err := errreport.NewSentryTransport(cfg.errorReport.dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	reporter := errreport.New(transport, errreport.Options{
+		Release:       version,
+		Environment:   cfg.env,
+		ServerName:    hostname,
+		InAppPrefixes: []string{"kyawzayarwin.com/greenlight/"},
+		RateLimit:     cfg.errorReport.rateLimit,
+		Burst:         cfg.errorReport.burst,
+		DedupWindow:   cfg.errorReport.dedupWindow,
+		OnError: func(err error) {
+			// Logged at warn, as an error would be reported again.
+			logger.PrintWarn("failed to send error report", map[string]any{"error": err.Error()})
+		},
+	})
+
+	return reporter, nil
+}
+
+// reportError sends err to the error tracker, with the request that failed, if
+// any, and the request ID, route and user logged with it.
+func (app *application) reportError(ctx context.Context, err error, r *http.Request) {
+	if app.errors == nil {
+		return
+	}
+
+	event := errreport.NewEvent(err)
+
+	properties := jsonlog.ContextProperties(ctx)
+
+	for _, key := range []string{"request_id", "route"} {
+		if value, ok := properties[key].(string); ok && value != "" {
+			event.Tags[key] = value
+		}
+	}
+
+	// The authenticate middleware sets user_id, while the user isn't in the
+	// context yet when an error happens before it.
+	id, _ := properties["user_id"].(int64)
+
+	if r != nil {
+		event.Request = errreport.NewRequest(r)
+		event.User = &errreport.User{ID: id, IPAddress: realip.FromRequest(r)}
+	} else if id != 0 {
+		event.User = &errreport.User{ID: id}
+	}
+
+	app.errors.Capture(event)
+}
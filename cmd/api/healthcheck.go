@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/health"
 )
 
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -11,9 +16,109 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 		"version":     version,
 	}
 
-	err := app.writeJSON(w, 200, data)
+	err := app.render(w, r, 200, data)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// livenessHandler tells an orchestrator that the process is up and shouldn't be
+// restarted. It doesn't look at the dependencies, which restarting wouldn't fix.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := envelope{
+		"status":      "available",
+		"environment": app.config.env,
+		"version":     version,
+	}
+
+	err := app.render(w, r, http.StatusOK, data)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler tells a load balancer whether to send traffic here. It responds
+// 503 Service Unavailable when a dependency check fails, and from the moment the
+// server starts shutting down, so that traffic is drained before it stops.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if app.shuttingDown.Load() {
+		err := app.render(w, r, http.StatusServiceUnavailable, envelope{"status": "shutting_down"})
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	report := health.Run(r.Context(), app.config.health.timeout, app.readinessChecks()...)
+
+	status, code := "available", http.StatusOK
+
+	if report.Status != health.StatusPass {
+		status, code = "unavailable", http.StatusServiceUnavailable
+
+		app.logger.PrintWarnContext(r.Context(), "readiness check failed", map[string]any{
+			"checks": report.Checks,
+		})
+	}
+
+	err := app.render(w, r, code, envelope{"status": status, "checks": report.Checks})
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) readinessChecks() []health.Check {
+	return []health.Check{
+		{
+			Name: "database",
+			Fn: func(ctx context.Context) error {
+				return app.database.PingContext(ctx)
+			},
+		},
+		{
+			// A binary deployed before its migrations ran would fail on the
+			// missing tables and columns.
+			Name: "migrations",
+			Fn: func(ctx context.Context) error {
+				version, err := app.models.Schema.Version(ctx)
+
+				if err != nil {
+					return err
+				}
+
+				if version != data.SchemaVersion {
+					return fmt.Errorf("database schema is at version %d, expected %d", version, data.SchemaVersion)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name: "smtp",
+			Fn:   app.mailer.Ping,
+		},
+		{
+			// Welcome and token emails are sent in the background, and a backlog of
+			// them means that the SMTP server is slow or something is stuck.
+			Name: "background",
+			Fn: func(ctx context.Context) error {
+				running := int(app.prom.backgroundRunning.Value())
+
+				if running > app.config.health.maxBackgroundJobs {
+					return fmt.Errorf("%d background jobs running, more than %d", running, app.config.health.maxBackgroundJobs)
+				}
+
+				return nil
+			},
+		},
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,8 +11,11 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
+	"kyawzayarwin.com/greenlight/internal/errreport"
+	"kyawzayarwin.com/greenlight/internal/render"
 	"kyawzayarwin.com/greenlight/internal/validator"
 )
 
@@ -32,12 +37,103 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// pickFields trims v down to the given top-level JSON fields. It works on the JSON
+// representation, so custom marshalers like data.Runtime still apply.
+func pickFields(v any, fields []string) (map[string]json.RawMessage, error) {
+	js, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+
+	err = json.Unmarshal(js, &all)
+
+	if err != nil {
+		return nil, err
+	}
+
+	picked := make(map[string]json.RawMessage, len(fields))
+
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			picked[field] = value
+		}
+	}
+
+	return picked, nil
+}
+
+// render writes the envelope in the format negotiated for the request, after the
+// response mapper of the request's API version has converted its values.
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, data envelope) error {
+	format := app.ContextGetFormat(r)
+	version := app.ContextGetVersion(r)
+
+	mapped := make(envelope, len(data))
+
+	for key, value := range data {
+		mapped[key] = version.response(value)
+	}
+
+	data = mapped
+
+	if format.Name == render.JSON.Name {
+		return app.writeJSON(w, status, data)
+	}
+
+	return render.Encode(w, status, format, data)
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	// Use http.MaxBytesReader() to limit the size of the request body to 1MB.
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
-	dec := json.NewDecoder(r.Body)
+	version := app.ContextGetVersion(r)
+
+	if version.mapRequest == nil {
+		return decodeJSON(r.Body, dst)
+	}
+
+	body, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		return err
+	}
+
+	body, err = version.request(body)
+
+	if err != nil {
+		return err
+	}
+
+	return decodeJSON(bytes.NewReader(body), dst)
+}
+
+// readBody reads the raw request body, limited to 1MB like readJSON.
+func (app *application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+
+	return body, nil
+}
+
+// decodeJSON decodes exactly one JSON value from src into dst, turning decoding
+// errors into messages that are safe to send back to the client.
+func decodeJSON(src io.Reader, dst any) error {
+	dec := json.NewDecoder(src)
 	dec.DisallowUnknownFields()
 
 	err := dec.Decode(dst)
@@ -113,6 +209,26 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readTime accepts either an RFC 3339 timestamp or a plain 2006-01-02 date, which
+// is taken as midnight UTC.
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+
+	return defaultValue
+}
+
 func (app *application) readCSV(qs url.Values, key string, defaultValues []string) []string {
 	s := qs.Get(key)
 
@@ -123,18 +239,33 @@ func (app *application) readCSV(qs url.Values, key string, defaultValues []strin
 	return strings.Split(s, ",")
 }
 
-func (app *application) background(fn func()) {
+// background runs fn in a goroutine that shutdown waits for. fn gets a copy of
+// ctx that isn't cancelled when the request ends, so that it keeps the request's
+// log properties and trace.
+func (app *application) background(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+
 	app.wg.Add(1)
+
+	app.prom.backgroundStarted.Inc()
+	app.prom.backgroundRunning.Inc()
+
 	// Launch a background goroutine.
 	go func() {
 		defer app.wg.Done()
+		defer app.prom.backgroundRunning.Dec()
 		// Recover any panic.
 		defer func() {
 			if err := recover(); err != nil {
-				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+				app.prom.backgroundFinished.Inc("panicked")
+				panicErr := errreport.NewPanicError(err)
+				app.logger.PrintErrorContext(ctx, panicErr, nil)
+				app.reportError(ctx, panicErr, nil)
 			}
 		}()
 		// Execute the arbitrary function that we passed as the parameter.
-		fn()
+		fn(ctx)
+
+		app.prom.backgroundFinished.Inc("completed")
 	}()
 }
@@ -6,16 +6,20 @@ import (
 	"expvar"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/errreport"
 	"kyawzayarwin.com/greenlight/internal/jsonlog"
 	"kyawzayarwin.com/greenlight/internal/mailer"
+	"kyawzayarwin.com/greenlight/internal/tracing"
 )
 
 var ( 
@@ -31,6 +35,9 @@ type config struct {
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+
+		slowQueryThreshold time.Duration
+		nPlusOneThreshold  int
 	}
 	limiter struct {
 		rps     float64
@@ -47,6 +54,65 @@ type config struct {
 	cors struct {
 		trustedOrigin []string
 	}
+	preconditions struct {
+		requireIfMatch bool
+	}
+	idempotency struct {
+		ttl           time.Duration
+		purgeInterval time.Duration
+	}
+	compression struct {
+		enabled      bool
+		minSize      int
+		contentTypes []string
+	}
+	cache struct {
+		enabled    bool
+		maxEntries int
+		ttl        time.Duration
+	}
+	versions struct {
+		v1Deprecation time.Time
+		v1Sunset      time.Time
+	}
+	openapi struct {
+		validate bool
+	}
+	log struct {
+		level      jsonlog.Level
+		stackLevel jsonlog.Level
+		sampling   jsonlog.Sampling
+	}
+	accessLog struct {
+		output      string
+		format      string
+		maxSize     int64
+		rotateEvery time.Duration
+		maxBackups  int
+		maxAge      time.Duration
+	}
+	health struct {
+		timeout           time.Duration
+		maxBackgroundJobs int
+	}
+	shutdown struct {
+		drain time.Duration
+	}
+	admin struct {
+		addr string
+	}
+	errorReport struct {
+		dsn         string
+		rateLimit   float64
+		burst       int
+		dedupWindow time.Duration
+	}
+	tracing struct {
+		exporter    string
+		file        string
+		endpoint    string
+		sampleRatio float64
+	}
 }
 
 type application struct {
@@ -55,7 +121,15 @@ type application struct {
 	logger   *jsonlog.Logger
 	models   data.Models
 	mailer   mailer.Mailer
+	prom     *promMetrics
+	tracer   *tracing.Tracer
+	errors   *errreport.Reporter
+	access   *accessLogger
 	wg       sync.WaitGroup
+
+	// shuttingDown is set once serve() starts a graceful shutdown, which fails
+	// the readiness check.
+	shuttingDown atomic.Bool
 }
 
 func main() {
@@ -71,6 +145,9 @@ func main() {
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 
+	flag.DurationVar(&cfg.db.slowQueryThreshold, "db-slow-query-threshold", 200*time.Millisecond, "Duration from which queries are logged as slow (0 disables)")
+	flag.IntVar(&cfg.db.nPlusOneThreshold, "db-n-plus-one-threshold", 3, "In development, warn about requests running the same query this many times (0 disables)")
+
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
@@ -80,6 +157,64 @@ func main() {
 		return nil
 	})
 
+	flag.BoolVar(&cfg.preconditions.requireIfMatch, "require-if-match", false, "Require an If-Match header on movie writes")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key are kept")
+	flag.DurationVar(&cfg.idempotency.purgeInterval, "idempotency-purge-interval", time.Hour, "How often expired idempotency keys are deleted (0 disables)")
+
+	flag.BoolVar(&cfg.compression.enabled, "compression-enabled", true, "Enable gzip and deflate response compression")
+	flag.IntVar(&cfg.compression.minSize, "compression-min-size", 1024, "Minimum response size in bytes before it gets compressed")
+
+	cfg.compression.contentTypes = []string{"application/json", "text/csv", "application/xml", "text/xml", "application/msgpack", "text/plain", "text/html"}
+
+	flag.Func("compression-types", "Content types that may be compressed (space separated)", func(s string) error {
+		cfg.compression.contentTypes = strings.Fields(s)
+		return nil
+	})
+
+	flag.BoolVar(&cfg.cache.enabled, "cache-enabled", true, "Cache movie reads in memory")
+	flag.IntVar(&cfg.cache.maxEntries, "cache-max-entries", 1000, "Maximum number of cached movie reads")
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", time.Minute, "How long movie reads stay cached")
+
+	// The dates are announced to every client, in the Deprecation and Sunset
+	// headers of v1 responses, so production won't start without them.
+	flag.Func("v1-deprecation", "Date v1 of the API was deprecated on, sent in the Deprecation header of v1 responses (YYYY-MM-DD, required in production)", func(s string) error {
+		return parseDateFlag(s, &cfg.versions.v1Deprecation)
+	})
+	flag.Func("v1-sunset", "Date v1 of the API stops being served, sent in the Sunset header of v1 responses (YYYY-MM-DD, required in production)", func(s string) error {
+		return parseDateFlag(s, &cfg.versions.v1Sunset)
+	})
+
+	flag.BoolVar(&cfg.openapi.validate, "openapi-validate", false, "Validate requests against the OpenAPI documents")
+
+	flag.TextVar(&cfg.log.level, "log-level", jsonlog.LevelInfo, "Minimum level of log entries (debug|info|warn|error|fatal|off)")
+	flag.TextVar(&cfg.log.stackLevel, "log-stack-level", jsonlog.LevelError, "Level from which log entries carry a stack trace (debug|info|warn|error|fatal|off)")
+	flag.IntVar(&cfg.log.sampling.Initial, "log-sample-initial", 0, "Entries with the same message logged each second before sampling kicks in (0 disables sampling)")
+	flag.IntVar(&cfg.log.sampling.Thereafter, "log-sample-thereafter", 100, "Once sampling, log every nth entry with the same message")
+
+	flag.StringVar(&cfg.accessLog.output, "access-log", "stdout", "Where to write the access log (off|stdout|path of a file)")
+	flag.StringVar(&cfg.accessLog.format, "access-log-format", "json", "Access log format (json|combined)")
+	flag.Int64Var(&cfg.accessLog.maxSize, "access-log-max-size", 100, "Size in megabytes the access log file is rotated at (0 for no limit)")
+	flag.DurationVar(&cfg.accessLog.rotateEvery, "access-log-rotate-every", 24*time.Hour, "How often the access log file is rotated (0 to only rotate by size)")
+	flag.IntVar(&cfg.accessLog.maxBackups, "access-log-max-backups", 7, "Rotated access log files to keep (0 for all)")
+	flag.DurationVar(&cfg.accessLog.maxAge, "access-log-max-age", 30*24*time.Hour, "How long rotated access log files are kept (0 for ever)")
+
+	flag.DurationVar(&cfg.health.timeout, "health-check-timeout", 2*time.Second, "Timeout of each readiness check")
+	flag.IntVar(&cfg.health.maxBackgroundJobs, "health-max-background-jobs", 100, "Background jobs running above which the readiness check fails")
+	flag.DurationVar(&cfg.shutdown.drain, "shutdown-drain", 5*time.Second, "How long to keep serving with a failing readiness check before shutting down, for load balancers to notice")
+
+	flag.StringVar(&cfg.admin.addr, "admin-addr", "localhost:4001", "Address of the admin listener serving /metrics and /debug/ (empty disables it)")
+
+	flag.StringVar(&cfg.tracing.exporter, "trace-exporter", "none", "Where to send traces (none|stdout|file|otlp)")
+	flag.StringVar(&cfg.tracing.file, "trace-file", "traces.jsonl", "File the file trace exporter appends to")
+	flag.StringVar(&cfg.tracing.endpoint, "trace-otlp-endpoint", "http://localhost:4318/v1/traces", "OTLP/HTTP traces endpoint of the collector")
+	flag.Float64Var(&cfg.tracing.sampleRatio, "trace-sample-ratio", 1, "Fraction of new traces to record (0-1)")
+
+	flag.StringVar(&cfg.errorReport.dsn, "error-report-dsn", os.Getenv("SENTRY_DSN"), "Sentry-compatible DSN panics and server errors are reported to (empty disables reporting)")
+	flag.Float64Var(&cfg.errorReport.rateLimit, "error-report-rate-limit", 1, "Error reports sent per second on average")
+	flag.IntVar(&cfg.errorReport.burst, "error-report-burst", 10, "Error reports sent in a burst above the rate limit")
+	flag.DurationVar(&cfg.errorReport.dedupWindow, "error-report-dedup-window", time.Minute, "How long repeats of a reported error are dropped for")
+
 	var smtpPort int
 
 	if envSmtpPort := os.Getenv("SMTP_PORT"); envSmtpPort != "" {
@@ -97,8 +232,33 @@ func main() {
 	// Create a new version boolean flag with the default value of false.
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
+	checkOpenAPI := flag.Bool("check-openapi", false, "Check that the OpenAPI documents match the routes and exit")
+
 	flag.Parse()
 
+	logger.SetLevel(cfg.log.level)
+	logger.SetStackLevel(cfg.log.stackLevel)
+
+	if cfg.log.sampling.Initial > 0 {
+		logger.SetSampling(cfg.log.sampling)
+	}
+
+	// Libraries that log with log/slog, or the log package, write through the
+	// same logger.
+	slog.SetDefault(slog.New(jsonlog.NewHandler(logger)))
+
+	if *checkOpenAPI {
+		app := application{config: cfg, logger: logger}
+
+		if err := app.checkOpenAPI(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Println("OpenAPI documents match the routes")
+		os.Exit(0)
+	}
+
 	if *displayVersion {
 		fmt.Printf("Version:\t%s\n", version)
 		// Print out the contents of the buildTime variable.
@@ -106,6 +266,10 @@ func main() {
 		os.Exit(0)
 	}
 
+	if err := validateVersionDates(cfg); err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := cfg.openDB(cfg.db.dsn)
 
 	if err != nil {
@@ -131,14 +295,50 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	var movieCache *data.MovieCache
+
+	if cfg.cache.enabled {
+		movieCache = data.NewMovieCache(cfg.cache.maxEntries, cfg.cache.ttl)
+
+		// Publish the movie cache hit and miss counters.
+		expvar.Publish("movie_cache", expvar.Func(func() interface{} {
+			return movieCache.Stats()
+		}))
+	}
+
+	tracer, err := newTracer(cfg, logger)
+
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	errorReporter, err := newErrorReporter(cfg, logger)
+
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	accessLog, err := newAccessLogger(cfg)
+
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := application{
 		config:   cfg,
 		logger:   logger,
-		models:   data.NewModels(db),
 		database: db,
+		prom:     newPromMetrics(db),
+		tracer:   tracer,
+		errors:   errorReporter,
+		access:   accessLog,
 		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 
+	// The models report their queries to the application, for the query metrics
+	// and logs.
+	app.models = data.NewModels(&data.DB{DB: db, OnQuery: app.observeQuery}, movieCache)
+
 	err = app.serve()
 
 	if err != nil {
@@ -174,3 +374,22 @@ func (cfg *config) openDB(dsn string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// parseDateFlag sets t to a YYYY-MM-DD date at midnight UTC, or to the zero time
+// when s is empty.
+func parseDateFlag(s string, t *time.Time) error {
+	if s == "" {
+		*t = time.Time{}
+		return nil
+	}
+
+	date, err := time.Parse(time.DateOnly, s)
+
+	if err != nil {
+		return err
+	}
+
+	*t = date
+
+	return nil
+}
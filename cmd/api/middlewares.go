@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"expvar"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,6 +21,9 @@ import (
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
 	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/errreport"
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+	"kyawzayarwin.com/greenlight/internal/render"
 	"kyawzayarwin.com/greenlight/internal/validator"
 )
 
@@ -24,7 +34,7 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		defer func() {
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+				app.serverErrorResponse(w, r, errreport.NewPanicError(err))
 			}
 		}()
 
@@ -60,7 +70,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	}()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !app.config.limiter.enabled {
+		if app.config.limiter.enabled {
 			ip := realip.FromRequest(r)
 
 			mu.Lock()
@@ -73,6 +83,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 			if !clients[ip].limiter.Allow() {
 				mu.Unlock()
+				app.prom.rateLimited.Inc()
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
@@ -113,7 +124,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.GetFromToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetFromToken(r.Context(), data.ScopeAuthentication, token)
 
 		if err != nil {
 			switch {
@@ -125,6 +136,12 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		jsonlog.SetProperty(r.Context(), "user_id", user.ID)
+
+		if info := app.ContextGetRequestInfo(r); info != nil {
+			info.userID = user.ID
+		}
+
 		r = app.ContextSetUser(r, user)
 		next.ServeHTTP(w, r)
 	})
@@ -165,7 +182,7 @@ func (app *application) requirePermission(code string, next http.Handler) http.H
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.ContextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
@@ -185,7 +202,7 @@ func (app *application) requirePermission(code string, next http.Handler) http.H
 
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Vary", "Origin")
+		w.Header().Add("Vary", "Origin")
 
 		origin := r.Header.Get("Origin")
 
@@ -193,13 +210,14 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigin {
 				if origin == app.config.cors.trustedOrigin[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Deprecation, Sunset, Link, Traceparent, X-Request-ID")
 					break
 				}
 
 				// Handle preflight request
 				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, Idempotency-Key")
 					w.Header().Set("Access-Control-Max-Age", "60")
 
 					w.WriteHeader(http.StatusOK)
@@ -212,6 +230,42 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// negotiate picks the response format from the ?format= parameter or the Accept
+// header, and answers with 406 Not Acceptable when none of them is supported.
+func (app *application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		format, err := render.Negotiate(r.Header.Get("Accept"), r.URL.Query().Get("format"))
+
+		if err != nil {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, app.ContextSetFormat(r, format))
+	})
+}
+
+// csvRows marks the handler of a route that lists rows, like movies. Only these
+// routes can respond with CSV; the others flatten into a table that makes no sense.
+type csvRows struct {
+	http.Handler
+}
+
+// refuseCSV answers requests for CSV with 406 Not Acceptable, before the handler
+// gets to change anything.
+func (app *application) refuseCSV(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.ContextGetFormat(r).Name == render.CSV.Name {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	totalRequestsReceived := expvar.NewInt("total_requests_received")
 	totalResponsesSent := expvar.NewInt("total_responses_sent")
@@ -220,6 +274,12 @@ func (app *application) metrics(next http.Handler) http.Handler {
 	// code.
 	totalResponsesSentByStatus := expvar.NewMap("total_responses_sent_by_status")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &requestInfo{}
+		r = app.ContextSetRequestInfo(r, info)
+
+		app.prom.requestsInFlight.Inc()
+		defer app.prom.requestsInFlight.Dec()
+
 		// Increment the requests received count, like before.
 		totalRequestsReceived.Add(1)
 		// Call the httpsnoop.CaptureMetrics() function, passing in the next handler in
@@ -235,9 +295,262 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		// Note that the expvar map is string-keyed, so we need to use the strconv.Itoa()
 		// function to convert the status code (which is an integer) to a string.
 		totalResponsesSentByStatus.Add(strconv.Itoa(metrics.Code), 1)
+
+		app.prom.requestDuration.Observe(metrics.Duration.Seconds(), methodLabel(r.Method), routeLabel(info.pattern), strconv.Itoa(metrics.Code))
+	})
+}
+
+// recordRoute tells the middleware around the router which route pattern matched
+// the request.
+func (app *application) recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := app.ContextGetRequestInfo(r); info != nil {
+			info.pattern = r.Pattern
+		}
+
+		jsonlog.SetProperty(r.Context(), "route", r.Pattern)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// idempotencyRecorder passes the response through to the client while keeping a
+// copy of it, so that it can be stored for replays.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// idempotent makes POST handlers safe to retry. The response to the first request
+// with a given Idempotency-Key header is stored per key and user, and replayed for
+// any retry within the configured window. A retry while the first request is still
+// running gets a 409, and reusing a key for a different request gets a 422. Server
+// errors aren't stored, so the request can be retried with the same key.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("idempotency key must not be more than 255 bytes long"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The same key must not be reused for another endpoint either, so the method
+		// and path are part of the fingerprint.
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+		hash.Write(body)
+		requestHash := hash.Sum(nil)
+
+		user := app.ContextGetUser(r)
+		userID := user.ID
+
+		// Anonymous clients all share user ID 0, so their keys are scoped to the
+		// client too, or two of them picking the same key would get each other's
+		// responses.
+		if user.IsAnonymous() {
+			key = anonymousIdempotencyScope(r, body) + ":" + key
+		}
+
+		stored, err := app.models.Idempotency.Reserve(r.Context(), key, userID, requestHash, app.config.idempotency.ttl)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyInProgress):
+				app.idempotencyKeyInProgressResponse(w, r)
+			case errors.Is(err, data.ErrIdempotencyKeyReused):
+				app.idempotencyKeyReusedResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if stored != nil {
+			for name, values := range stored.Headers {
+				// The replay is a request of its own, with its own ID and trace.
+				if name == "X-Request-Id" || name == "Traceparent" {
+					continue
+				}
+
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+
+		// Release the key if the handler panics, so that it isn't stuck in progress
+		// until it expires.
+		defer func() {
+			if err := recover(); err != nil {
+				app.releaseIdempotencyKey(r.Context(), key, userID)
+				panic(err)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 || rec.status >= 500 {
+			app.releaseIdempotencyKey(r.Context(), key, userID)
+			return
+		}
+
+		// The body is recorded before the compress middleware gets to it, so the
+		// headers describing the encoding on the wire are left out. The replay goes
+		// through the middleware again and gets its own.
+		headers := w.Header().Clone()
+
+		for _, name := range []string{"Content-Encoding", "Content-Length", "Vary"} {
+			headers.Del(name)
+		}
+
+		err = app.models.Idempotency.Complete(context.WithoutCancel(r.Context()), key, userID, data.IdempotentResponse{
+			Status:  rec.status,
+			Headers: headers,
+			Body:    rec.body.Bytes(),
+		})
+
+		if err != nil {
+			app.logError(err, r)
+		}
 	})
 }
 
+// anonymousIdempotencyScope identifies the client of an anonymous request: by the
+// email in the body, normalized, as registering is the only anonymous request that
+// takes a key, or by the IP address without one.
+func anonymousIdempotencyScope(r *http.Request, body []byte) string {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	json.Unmarshal(body, &input)
+
+	client := strings.ToLower(strings.TrimSpace(input.Email))
+
+	if client == "" {
+		client = "ip " + realip.FromRequest(r)
+	}
+
+	sum := sha256.Sum256([]byte(client))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys every interval, until
+// stop is closed. Reserve only deletes an expired key when it's used again.
+func (app *application) purgeIdempotencyKeys(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			purged, err := app.models.Idempotency.PurgeExpired(context.Background())
+
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			app.logger.PrintDebug("purged expired idempotency keys", map[string]any{"keys": purged})
+		}
+	}
+}
+
+func (app *application) releaseIdempotencyKey(ctx context.Context, key string, userID int64) {
+	// The key has to be released even when the client has gone away, or retries
+	// would be turned away until it expires.
+	err := app.models.Idempotency.Release(context.WithoutCancel(ctx), key, userID)
+
+	if err != nil {
+		app.logger.PrintErrorContext(ctx, err, map[string]any{"idempotency_key": key})
+	}
+}
+
+// requestID gives every request an ID, which is sent back in the X-Request-ID
+// header and in error responses, and logged with everything logged while handling
+// the request. An X-Request-ID set by the client or a proxy in front is kept, as
+// long as it's a reasonable ID, so that its logs can be matched with ours.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, app.ContextSetRequestID(r, id))
+	})
+}
+
+// validRequestID allows IDs of up to 128 letters, digits and the punctuation
+// found in UUIDs and the IDs of common proxies, which keeps them safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune("-_.:+=/", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func CreateMiddlewareStack(xs ...Middleware) Middleware {
 	return func(next http.Handler) http.Handler {
 		for i := len(xs) - 1; i >= 0; i-- {
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/patch"
 	"kyawzayarwin.com/greenlight/internal/validator"
 )
 
@@ -21,7 +29,8 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	err := app.readJSON(w, r, &input)
 
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
@@ -38,10 +47,11 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(r.Context(), movie)
 
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	for _, v := range movie.Genres {
@@ -49,10 +59,10 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 			Title: v,
 		}
 
-		err = app.models.Genres.Insert(&genre)
+		err = app.models.Genres.Insert(r.Context(), &genre)
 
 		if err != nil {
-			app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+			app.serverErrorResponse(w, r, err)
 			return
 		}
 
@@ -61,54 +71,105 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 			GenreID: genre.ID,
 		}
 
-		err = app.models.MoviesGenres.AddMovieToGenre(movieGenres)
+		err = app.models.MoviesGenres.AddMovieToGenre(r.Context(), movieGenres)
 
 		if err != nil {
-			app.errorResponse(w, r, http.StatusInternalServerError, err.Error())
+			app.serverErrorResponse(w, r, err)
 			return
 		}
 	}
 
-	fmt.Fprintf(w, "%+v\n", input)
+	// Tell the client where the new movie is, under the version it was created
+	// through.
+	version := app.ContextGetVersion(r)
+
+	w.Header().Set("Location", fmt.Sprintf("/%s/movies/%d", version.name, movie.ID))
+	setMovieValidators(w, movie)
+
+	err = app.render(w, r, http.StatusCreated, envelope{"movies": movie})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieQuery
 		data.Filters
+		data.FacetOptions
 	}
 
 	qs := r.URL.Query()
 
 	v := validator.New()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	version := app.ContextGetVersion(r)
+
+	input.MovieQuery = app.readMovieQuery(qs, v)
+	fields := app.readMovieFields(qs, version.movieFields, v)
+	input.IncludeGenres = validator.In("genres", fields...)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 10, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime", data.SortRelevance}
+	input.Facets = app.readCSV(qs, "facets", []string{})
+	input.YearInterval = app.readString(qs, "facet_year_interval", "decade")
 
 	data.ValidateFilter(v, input.Filters)
+	data.ValidateMovieQuery(v, input.MovieQuery, input.Filters)
+	data.ValidateFacetOptions(v, input.FacetOptions)
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	fmt.Printf("%+v\n", input)
-
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.movieReader(r).GetAll(r.Context(), input.MovieQuery, input.Filters)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{
+	env := envelope{
 		"movies":   movies,
 		"metadata": metadata,
-	})
+	}
+
+	if qs.Has("fields") {
+		picked := make([]map[string]json.RawMessage, len(movies))
+
+		for i := range movies {
+			picked[i], err = pickFields(version.response(movies[i]), fields)
+
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		env["movies"] = picked
+	}
+
+	// Facets are opt-in as they cost an extra aggregate query over the whole
+	// filtered result set.
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.GetFacets(r.Context(), input.MovieQuery, input.FacetOptions)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["facets"] = facets
+	}
+
+	err = app.render(w, r, http.StatusOK, env)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -121,7 +182,20 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	version := app.ContextGetVersion(r)
+
+	fields := app.readMovieFields(qs, version.movieFields, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.movieReader(r).Get(r.Context(), id)
 
 	if err != nil {
 		switch {
@@ -133,7 +207,25 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movie})
+	setMovieValidators(w, movie)
+
+	if notModified(r, movie) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	env := envelope{"movies": movie}
+
+	if qs.Has("fields") {
+		env["movies"], err = pickFields(version.response(movie), fields)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render(w, r, http.StatusOK, env)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -150,7 +242,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.uncachedMovies().Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -161,34 +253,55 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+	if !app.checkIfMatch(w, r, movie) {
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
 
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
+	switch contentType {
+	case patch.MergePatchContentType, patch.JSONPatchContentType:
+		err = app.patchMovie(w, r, contentType, movie)
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
+		if err != nil {
+			switch {
+			case errors.Is(err, patch.ErrTestFailed):
+				app.errorResponse(w, r, http.StatusConflict, err.Error())
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+	default:
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
 
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
+		err = app.readJSON(w, r, &input)
 
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
-	}
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
 	}
 
 	v := validator.New()
@@ -198,10 +311,12 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(r.Context(), movie)
 
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -216,7 +331,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	for _, v := range movie.Genres {
 		genre := &data.Genre{Title: v}
 
-		err := app.models.Genres.Insert(genre)
+		err := app.models.Genres.Insert(r.Context(), genre)
 
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
@@ -231,14 +346,16 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		)
 	}
 
-	err = app.models.MoviesGenres.BulkUpdateMoviesFromGenre(movie.ID, moviesGenres)
+	err = app.models.MoviesGenres.BulkUpdateMoviesFromGenre(r.Context(), movie.ID, moviesGenres)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movie})
+	setMovieValidators(w, movie)
+
+	err = app.render(w, r, http.StatusOK, envelope{"movies": movie})
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -256,22 +373,325 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	// Deletes without preconditions don't need to know the current version.
+	if r.Header.Get("If-Match") == "" && !app.config.preconditions.requireIfMatch {
+		err = app.models.Movies.Delete(r.Context(), id)
+	} else {
+		var movie *data.Movie
+
+		movie, err = app.uncachedMovies().Get(r.Context(), id)
+
+		if err == nil {
+			if !app.checkIfMatch(w, r, movie) {
+				return
+			}
+
+			err = app.models.Movies.DeleteVersion(r.Context(), movie.ID, movie.Version)
+		}
+	}
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"})
+	err = app.render(w, r, http.StatusOK, envelope{"message": "movie successfully deleted"})
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
+
+func (app *application) bulkMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs       []int             `json:"ids"`
+		Filter    map[string]string `json:"filter"`
+		Operation struct {
+			Type  string          `json:"type"`
+			Genre string          `json:"genre"`
+			Field string          `json:"field"`
+			Value json.RawMessage `json:"value"`
+		} `json:"operation"`
+		Preview bool `json:"preview"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	op := data.BulkOperation{
+		Type:  input.Operation.Type,
+		Genre: input.Operation.Genre,
+		Field: input.Operation.Field,
+	}
+
+	if op.Type == data.BulkSetField && input.Operation.Value != nil {
+		op.Value, err = decodeBulkValue(op.Field, input.Operation.Value)
+
+		if err != nil {
+			v.AddError("operation.value", fmt.Sprintf("must be a valid %s", op.Field))
+		}
+	}
+
+	data.ValidateBulkOperation(v, op)
+
+	v.Check((input.IDs != nil) != (input.Filter != nil), "ids", "either ids or filter must be provided, but not both")
+	v.Check(len(input.IDs) <= data.MaxBulkItems, "ids", fmt.Sprintf("must not contain more than %d ids", data.MaxBulkItems))
+	v.Check(len(slices.Compact(slices.Sorted(slices.Values(input.IDs)))) == len(input.IDs), "ids", "must not contain duplicate values")
+
+	// The filter takes the same parameters as the movies list, so it's read the
+	// same way.
+	var query data.MovieQuery
+
+	if input.Filter != nil {
+		qs := url.Values{}
+
+		for key, value := range input.Filter {
+			qs.Set(key, value)
+		}
+
+		query = app.readMovieQuery(qs, v)
+		data.ValidateMovieQuery(v, query, data.Filters{Sort: "id"})
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ids := input.IDs
+
+	if input.Filter != nil {
+		ids, err = app.models.Movies.FindIDs(r.Context(), query, data.MaxBulkItems+1)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if len(ids) > data.MaxBulkItems {
+			v.AddError("filter", fmt.Sprintf("must not match more than %d movies", data.MaxBulkItems))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	results, err := app.models.Movies.Bulk(r.Context(), ids, op, input.Preview)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrBulkFailed):
+			err = app.render(w, r, http.StatusUnprocessableEntity, envelope{
+				"error":   "the operation is invalid for some movies, no changes were made",
+				"results": results,
+			})
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.render(w, r, http.StatusOK, envelope{
+		"preview": input.Preview,
+		"count":   len(results),
+		"results": results,
+	})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// decodeBulkValue decodes the value of a set_field bulk operation into the Go type
+// of the field.
+func decodeBulkValue(field string, raw json.RawMessage) (any, error) {
+	var err error
+
+	switch field {
+	case "title":
+		var title string
+		err = json.Unmarshal(raw, &title)
+		return title, err
+	case "year":
+		var year int32
+		err = json.Unmarshal(raw, &year)
+		return year, err
+	case "runtime":
+		var runtime data.Runtime
+		err = json.Unmarshal(raw, &runtime)
+		return runtime, err
+	}
+
+	// Unknown fields are reported by data.ValidateBulkOperation.
+	return nil, nil
+}
+
+// movieReader returns the model to read movies with. Clients can skip the cache
+// with a Cache-Control: no-cache request header.
+func (app *application) movieReader(r *http.Request) data.MovieInterface {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.TrimSpace(directive) == "no-cache" {
+			return app.uncachedMovies()
+		}
+	}
+
+	return app.models.Movies
+}
+
+// uncachedMovies returns the movie model without the cache in front of it. Writes
+// read through it, so that version checks never see a stale copy.
+func (app *application) uncachedMovies() data.MovieInterface {
+	if cached, ok := app.models.Movies.(data.CachedMovieModel); ok {
+		return cached.Base
+	}
+
+	return app.models.Movies
+}
+
+// readMovieQuery reads the movie search criteria from the query string. Genres
+// prefixed with a minus sign, like genres=drama,-horror, are excluded.
+func (app *application) readMovieQuery(qs url.Values, v *validator.Validator) data.MovieQuery {
+	query := data.MovieQuery{
+		Title:         app.readString(qs, "title", ""),
+		Language:      app.readString(qs, "lang", "simple"),
+		Genres:        []string{},
+		GenresAny:     []string{},
+		ExcludeGenres: []string{},
+		YearMin:       app.readInt(qs, "year_min", 0, v),
+		YearMax:       app.readInt(qs, "year_max", 0, v),
+		RuntimeMin:    app.readInt(qs, "runtime_min", 0, v),
+		RuntimeMax:    app.readInt(qs, "runtime_max", 0, v),
+		CreatedAfter:  app.readTime(qs, "created_after", time.Time{}, v),
+		CreatedBefore: app.readTime(qs, "created_before", time.Time{}, v),
+	}
+
+	for _, genre := range app.readCSV(qs, "genres", []string{}) {
+		if excluded, ok := strings.CutPrefix(genre, "-"); ok {
+			query.ExcludeGenres = append(query.ExcludeGenres, excluded)
+			continue
+		}
+		query.Genres = append(query.Genres, genre)
+	}
+
+	for _, genre := range app.readCSV(qs, "genres_any", []string{}) {
+		if excluded, ok := strings.CutPrefix(genre, "-"); ok {
+			query.ExcludeGenres = append(query.ExcludeGenres, excluded)
+			continue
+		}
+		query.GenresAny = append(query.GenresAny, genre)
+	}
+
+	return query
+}
+
+// readMovieFields returns the movie fields the client asked for with ?fields= and
+// ?include=, out of the fields in safelist. Without either parameter every field is
+// returned, genres included. Related data named in include is added to the selected
+// fields.
+func (app *application) readMovieFields(qs url.Values, safelist []string, v *validator.Validator) []string {
+	fields := app.readCSV(qs, "fields", slices.Clone(safelist))
+	includes := app.readCSV(qs, "include", []string{})
+
+	for _, field := range fields {
+		v.Check(validator.In(field, safelist...), "fields", fmt.Sprintf("invalid field, must be one of %s", strings.Join(safelist, ",")))
+	}
+
+	for _, include := range includes {
+		v.Check(validator.In(include, data.MovieIncludes...), "include", fmt.Sprintf("invalid include, must be one of %s", strings.Join(data.MovieIncludes, ",")))
+
+		if !validator.In(include, fields...) {
+			fields = append(fields, include)
+		}
+	}
+
+	return fields
+}
+
+// movieDocumentFields are the fields of the JSON document that merge patches and
+// JSON patches operate on. The id and version are left out, so patches can't
+// change them.
+var movieDocumentFields = []string{"title", "year", "runtime", "genres"}
+
+// movieDocument decodes a patched document.
+type movieDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+}
+
+// patchMovie applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) from
+// the request body to the movie. Unlike the plain JSON partial update, a merge
+// patch can clear a value with null, and a JSON patch can add or remove a single
+// genre with a path like /genres/- or /genres/0.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, contentType string, movie *data.Movie) error {
+	body, err := app.readBody(w, r)
+
+	if err != nil {
+		return err
+	}
+
+	// The document is in the shape of the request's API version, so that paths and
+	// test values match what the client reads from the API.
+	version := app.ContextGetVersion(r)
+
+	fields, err := pickFields(version.response(movie), movieDocumentFields)
+
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(fields)
+
+	if err != nil {
+		return err
+	}
+
+	switch contentType {
+	case patch.MergePatchContentType:
+		doc, err = patch.Merge(doc, body)
+	case patch.JSONPatchContentType:
+		doc, err = patch.Apply(doc, body)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	doc, err = version.request(doc)
+
+	if err != nil {
+		return err
+	}
+
+	var patched movieDocument
+
+	err = decodeJSON(bytes.NewReader(doc), &patched)
+
+	if err != nil {
+		return err
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return nil
+}
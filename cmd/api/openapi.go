@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"kyawzayarwin.com/greenlight/internal/openapi"
+)
+
+// openAPIHandler serves the OpenAPI document of the request's API version.
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(app.ContextGetVersion(r).spec.JSON())
+}
+
+// docsHandler serves a page that renders the OpenAPI document.
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openapi.DocsPage())
+}
+
+// validateRequest rejects requests that don't match the documented operation with
+// a 422, before they reach the handler. The body is read up front and put back for
+// the handler.
+func (app *application) validateRequest(op *openapi.Operation, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+
+		if op.HasRequestBody() {
+			maxBytes := 1_048_576
+
+			var err error
+
+			body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if errs := op.Validate(r, body); len(errs) > 0 {
+			app.failedValidationResponse(w, r, errs)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOpenAPI compares the routes of every API version with its OpenAPI document,
+// so that neither can change without the other.
+func (app *application) checkOpenAPI() error {
+	served := []openapi.Route{}
+
+	for _, rt := range app.apiRoutes() {
+		served = append(served, openapi.Route{Method: rt.method, Path: rt.path})
+	}
+
+	problems := []string{}
+
+	for _, version := range app.apiVersions() {
+		undocumented, unserved := version.spec.Diff(served)
+
+		for _, rt := range undocumented {
+			problems = append(problems, fmt.Sprintf("%s: %s is served but not documented", version.name, rt))
+		}
+
+		for _, rt := range unserved {
+			problems = append(problems, fmt.Sprintf("%s: %s is documented but not served", version.name, rt))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
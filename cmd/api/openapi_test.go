@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+)
+
+// TestOpenAPIMatchesRoutes fails when a route is added or removed without updating
+// the OpenAPI documents, or the other way round.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelOff)}
+
+	if len(app.apiRoutes()) == 0 {
+		t.Fatal("apiRoutes() returned no routes")
+	}
+
+	if err := app.checkOpenAPI(); err != nil {
+		t.Errorf("OpenAPI documents don't match the routes:\n%s", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+// readUser returns the user whose id is in the path, or sends a response and
+// returns nil when there's no such user.
+func (app *application) readUser(w http.ResponseWriter, r *http.Request) *data.User {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	user, err := app.models.Users.Get(r.Context(), id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return nil
+	}
+
+	return user
+}
+
+// renderUserPermissions responds with every permission the user has.
+func (app *application) renderUserPermissions(w http.ResponseWriter, r *http.Request, user *data.User) {
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render(w, r, http.StatusOK, envelope{"permissions": permissions})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	app.renderUserPermissions(w, r, user)
+}
+
+// grantUserPermissionsHandler grants permissions to a user, on top of those they
+// already have.
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePermissionCodes(v, input.Permissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.readUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	// The grant is recorded in the audit log by AddForUser.
+	err = app.models.Permissions.AddForUser(r.Context(), user.ID, app.auditEvent(r, data.AuditEvent{}), input.Permissions...)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.renderUserPermissions(w, r, user)
+}
+
+// revokeUserPermissionHandler revokes one permission from a user. Revoking a
+// permission the user doesn't have succeeds, as the user ends up without it.
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	if !validator.In(code, data.PermissionCodes...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.readUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	// The revocation is recorded in the audit log by RemoveForUser.
+	err := app.models.Permissions.RemoveForUser(r.Context(), user.ID, app.auditEvent(r, data.AuditEvent{}), code)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.renderUserPermissions(w, r, user)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"runtime"
+
+	"kyawzayarwin.com/greenlight/internal/metrics"
+)
+
+// promMetrics are the metrics served at /metrics on the admin listener, in the
+// Prometheus format. The expvar counters at /debug/vars are kept alongside them.
+type promMetrics struct {
+	registry *metrics.Registry
+
+	requestDuration  *metrics.Histogram
+	requestsInFlight *metrics.Gauge
+	rateLimited      *metrics.Counter
+
+	backgroundStarted  *metrics.Counter
+	backgroundFinished *metrics.Counter
+	backgroundRunning  *metrics.Gauge
+
+	queryDuration *metrics.Histogram
+	queryRows     *metrics.Counter
+	queryErrors   *metrics.Counter
+}
+
+func newPromMetrics(db *sql.DB) *promMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &promMetrics{
+		registry: reg,
+
+		requestDuration:  reg.NewHistogram("http_request_duration_seconds", "Time taken to handle HTTP requests.", metrics.DefBuckets, "method", "route", "status"),
+		requestsInFlight: reg.NewGauge("http_requests_in_flight", "HTTP requests being handled."),
+		rateLimited:      reg.NewCounter("http_rate_limited_requests_total", "Requests rejected by the rate limiter."),
+
+		backgroundStarted:  reg.NewCounter("background_jobs_started_total", "Background jobs started."),
+		backgroundFinished: reg.NewCounter("background_jobs_finished_total", "Background jobs finished, by whether they completed or panicked.", "result"),
+		backgroundRunning:  reg.NewGauge("background_jobs_running", "Background jobs running."),
+
+		queryDuration: reg.NewHistogram("db_query_duration_seconds", "Time taken by database queries, by the model method that ran them.", metrics.DefBuckets, "query"),
+		queryRows:     reg.NewCounter("db_query_rows_total", "Rows returned or affected by database queries.", "query"),
+		queryErrors:   reg.NewCounter("db_query_errors_total", "Database queries that failed.", "query"),
+	}
+
+	reg.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+
+	if db != nil {
+		registerDBStats(reg, db)
+	}
+
+	return m
+}
+
+// registerDBStats exports the connection pool statistics of db. They're read when
+// scraped, so they're always current.
+func registerDBStats(reg *metrics.Registry, db *sql.DB) {
+	gauge := func(name, help string, fn func(sql.DBStats) float64) {
+		reg.NewGaugeFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+
+	counter := func(name, help string, fn func(sql.DBStats) float64) {
+		reg.NewCounterFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+
+	gauge("db_max_open_connections", "Maximum number of open connections to the database.", func(s sql.DBStats) float64 {
+		return float64(s.MaxOpenConnections)
+	})
+	gauge("db_open_connections", "Established connections to the database, in use or idle.", func(s sql.DBStats) float64 {
+		return float64(s.OpenConnections)
+	})
+	gauge("db_in_use_connections", "Connections to the database currently in use.", func(s sql.DBStats) float64 {
+		return float64(s.InUse)
+	})
+	gauge("db_idle_connections", "Idle connections to the database.", func(s sql.DBStats) float64 {
+		return float64(s.Idle)
+	})
+	counter("db_wait_count_total", "Connections waited for.", func(s sql.DBStats) float64 {
+		return float64(s.WaitCount)
+	})
+	counter("db_wait_duration_seconds_total", "Time spent waiting for connections.", func(s sql.DBStats) float64 {
+		return s.WaitDuration.Seconds()
+	})
+	counter("db_max_idle_closed_total", "Connections closed due to the idle connection limit.", func(s sql.DBStats) float64 {
+		return float64(s.MaxIdleClosed)
+	})
+	counter("db_max_idle_time_closed_total", "Connections closed due to the idle time limit.", func(s sql.DBStats) float64 {
+		return float64(s.MaxIdleTimeClosed)
+	})
+	counter("db_max_lifetime_closed_total", "Connections closed due to the connection lifetime limit.", func(s sql.DBStats) float64 {
+		return float64(s.MaxLifetimeClosed)
+	})
+}
+
+// methodLabel keeps the method label to the standard methods, so that clients
+// can't create series at will.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
+
+// routeLabel is the pattern of the route that handled the request, like
+// "GET /v1/movies/{id}", rather than the path, which would give a series per movie.
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+
+	return pattern
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+)
+
+// observeQuery is the models' query hook. It records the metrics of every query,
+// logs the slow ones, and counts them for the N+1 check.
+func (app *application) observeQuery(ctx context.Context, stats data.QueryStats) {
+	app.prom.queryDuration.Observe(stats.Duration.Seconds(), stats.Name)
+	app.prom.queryRows.Add(float64(stats.Rows), stats.Name)
+
+	if stats.Err != nil {
+		app.prom.queryErrors.Inc(stats.Name)
+	}
+
+	if threshold := app.config.db.slowQueryThreshold; threshold > 0 && stats.Duration >= threshold {
+		properties := map[string]any{
+			"query_name": stats.Name,
+			"query":      strings.Join(strings.Fields(stats.Query), " "),
+			"args":       redactArgs(stats.Args),
+			"duration":   stats.Duration,
+			"rows":       stats.Rows,
+		}
+
+		if stats.Err != nil {
+			properties["error"] = stats.Err
+		}
+
+		app.logger.PrintWarnContext(ctx, "slow query", properties)
+	}
+
+	if counts := contextGetQueryCounts(ctx); counts != nil {
+		counts.add(stats.Name)
+	}
+}
+
+// redactArgs describes the parameters of a query by their type, and their length
+// for strings and bytes, as the values can be passwords, tokens and email addresses.
+func redactArgs(args []any) []string {
+	redacted := make([]string, len(args))
+
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			redacted[i] = "null"
+		case string:
+			redacted[i] = fmt.Sprintf("string(%d)", len(v))
+		case []byte:
+			redacted[i] = fmt.Sprintf("bytes(%d)", len(v))
+		default:
+			redacted[i] = fmt.Sprintf("%T", v)
+		}
+	}
+
+	return redacted
+}
+
+// queryCounts counts the queries of a request by name.
+type queryCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *queryCounts) add(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[name]++
+}
+
+// repeated returns the queries that ran at least threshold times, with their
+// counts.
+func (c *queryCounts) repeated(threshold int) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	repeated := make(map[string]int)
+
+	for name, n := range c.counts {
+		if n >= threshold {
+			repeated[name] = n
+		}
+	}
+
+	return repeated
+}
+
+// detectNPlusOne warns, in development, about requests that run the same query
+// over and over, like one insert per genre of a movie, which usually means that a
+// loop should be a single query.
+func (app *application) detectNPlusOne(next http.Handler) http.Handler {
+	threshold := app.config.db.nPlusOneThreshold
+
+	if app.config.env != "development" || threshold <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counts := &queryCounts{counts: make(map[string]int)}
+
+		r = app.ContextSetQueryCounts(r, counts)
+
+		next.ServeHTTP(w, r)
+
+		repeated := counts.repeated(threshold)
+
+		for _, name := range slices.Sorted(maps.Keys(repeated)) {
+			app.logger.PrintWarnContext(r.Context(), "possible N+1 query", map[string]any{
+				"query_name": name,
+				"count":      repeated[name],
+			})
+		}
+	})
+}
@@ -1,43 +1,92 @@
 package main
 
 import (
-	"expvar"
 	"net/http"
 
 	"kyawzayarwin.com/greenlight/internal/data"
 )
 
-func (app *application) routes() http.Handler {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("GET /v1/healthcheck", app.healthCheckHandler)
+// route is an API endpoint, with a path relative to the version prefix.
+type route struct {
+	method  string
+	path    string
+	handler http.Handler
+}
 
+// apiRoutes lists the endpoints that every API version serves.
+func (app *application) apiRoutes() []route {
 	protectedRoutes := CreateMiddlewareStack(
 		app.requireActivateUser,
 	)
 
-	// movies handler
-	mux.Handle("GET /v1/movies", protectedRoutes(app.requirePermission(data.PermissionMovieRead, http.HandlerFunc(app.listMoviesHandler))))
-	mux.Handle("POST /v1/movies", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, http.HandlerFunc(app.createMovieHandler))))
-	mux.Handle("GET /v1/movies/{id}", protectedRoutes(app.requirePermission(data.PermissionMovieRead, http.HandlerFunc(app.showMovieHandler))))
-	mux.Handle("PATCH /v1/movies/{id}", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, http.HandlerFunc(app.updateMovieHandler))))
-	mux.Handle("DELETE /v1/movies/{id}", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, http.HandlerFunc(app.deleteMovieHandler))))
+	return []route{
+		{"GET", "/healthcheck", http.HandlerFunc(app.healthCheckHandler)},
+		{"GET", "/healthz/live", http.HandlerFunc(app.livenessHandler)},
+		{"GET", "/healthz/ready", http.HandlerFunc(app.readinessHandler)},
+
+		// movies handler
+		{"GET", "/movies", csvRows{protectedRoutes(app.requirePermission(data.PermissionMovieRead, http.HandlerFunc(app.listMoviesHandler)))}},
+		{"POST", "/movies", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, app.idempotent(http.HandlerFunc(app.createMovieHandler))))},
+		{"POST", "/movies/bulk", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, app.idempotent(http.HandlerFunc(app.bulkMoviesHandler))))},
+		{"GET", "/movies/{id}", protectedRoutes(app.requirePermission(data.PermissionMovieRead, http.HandlerFunc(app.showMovieHandler)))},
+		{"PATCH", "/movies/{id}", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, http.HandlerFunc(app.updateMovieHandler)))},
+		{"DELETE", "/movies/{id}", protectedRoutes(app.requirePermission(data.PermissionMovieWrite, http.HandlerFunc(app.deleteMovieHandler)))},
+
+		// Users Handlers
+		{"POST", "/users", app.idempotent(http.HandlerFunc(app.registerUserHandler))},
+		{"PUT", "/users/activated", http.HandlerFunc(app.activateUserHandler)},
+		{"POST", "/tokens/authentication", http.HandlerFunc(app.createAuthenticationTokenHandler)},
+		{"POST", "/tokens/activation", http.HandlerFunc(app.createActivationTokenHandler)},
+		{"POST", "/tokens/password-reset", http.HandlerFunc(app.createPasswordResetTokenHandler)},
+		{"PUT", "/users/password", http.HandlerFunc(app.updateUserPasswordHandler)},
+
+		// Admin Handlers
+		{"GET", "/admin/audit", csvRows{protectedRoutes(app.requirePermission(data.PermissionAdminAudit, http.HandlerFunc(app.listAuditEventsHandler)))}},
+		{"GET", "/admin/audit/verify", protectedRoutes(app.requirePermission(data.PermissionAdminAudit, http.HandlerFunc(app.verifyAuditEventsHandler)))},
+		{"GET", "/admin/users/{id}/permissions", protectedRoutes(app.requirePermission(data.PermissionAdminPermissions, http.HandlerFunc(app.showUserPermissionsHandler)))},
+		{"POST", "/admin/users/{id}/permissions", protectedRoutes(app.requirePermission(data.PermissionAdminPermissions, http.HandlerFunc(app.grantUserPermissionsHandler)))},
+		{"DELETE", "/admin/users/{id}/permissions/{code}", protectedRoutes(app.requirePermission(data.PermissionAdminPermissions, http.HandlerFunc(app.revokeUserPermissionHandler)))},
+
+		// Documentation Handlers
+		{"GET", "/openapi.json", http.HandlerFunc(app.openAPIHandler)},
+		{"GET", "/docs", http.HandlerFunc(app.docsHandler)},
+	}
+}
+
+func (app *application) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	versions := app.apiVersions()
+	latest := versions[len(versions)-1].name
+
+	// Each version serves the same routes under its own prefix, like /v1/movies
+	// and /v2/movies.
+	for _, version := range versions {
+		for _, rt := range app.apiRoutes() {
+			handler := rt.handler
+
+			if _, ok := rt.handler.(csvRows); !ok {
+				handler = app.refuseCSV(handler)
+			}
 
-	// Users Handlers
-	mux.HandleFunc("POST /v1/users", app.registerUserHandler)
-	mux.HandleFunc("PUT /v1/users/activated", app.activateUserHandler)
-	mux.HandleFunc("POST /v1/tokens/authentication", app.createAuthenticationTokenHandler)
-	mux.HandleFunc("POST /v1/tokens/activation", app.createActivationTokenHandler)
-	mux.HandleFunc("POST /v1/tokens/password-reset", app.createPasswordResetTokenHandler)
-	mux.HandleFunc("PUT /v1/users/password", app.updateUserPasswordHandler)
+			if op, ok := version.spec.Operation(rt.method, rt.path); ok && app.config.openapi.validate {
+				handler = app.validateRequest(op, handler)
+			}
 
-	// Debug Handlers
-	mux.Handle("GET /debug/vars", expvar.Handler())
+			mux.Handle(rt.method+" /"+version.name+rt.path, app.recordRoute(app.versioned(version, latest, handler)))
+		}
+	}
 
 	defaultMiddleWare := CreateMiddlewareStack(
+		app.requestID,
 		app.metrics,
+		app.accessLog,
+		app.detectNPlusOne,
+		app.trace,
 		app.recoverPanic,
+		app.compress,
 		app.enableCORS,
+		app.negotiate,
 		app.rateLimit,
 		app.authenticate,
 	)
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
 )
 
 func (app *application) serve() error {
@@ -19,13 +23,54 @@ func (app *application) serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		ErrorLog:     slog.NewLogLogger(jsonlog.NewHandler(app.logger), slog.LevelWarn),
 	}
 	// Likewise log a "starting server" message.
-	app.logger.PrintInfo("starting server", map[string]string{
+	app.logger.PrintInfo("starting server", map[string]any{
 		"addr": srv.Addr,
 		"env":  app.config.env,
 	})
 
+	// The admin listener is opened before the API's, so that a bad address fails
+	// the start.
+	var adminSrv *http.Server
+
+	if app.config.admin.addr != "" {
+		adminSrv = &http.Server{
+			Addr:        app.config.admin.addr,
+			Handler:     app.adminRoutes(),
+			IdleTimeout: time.Minute,
+			ReadTimeout: 10 * time.Second,
+			// CPU profiles and execution traces take 30 seconds by default.
+			WriteTimeout: 2 * time.Minute,
+			ErrorLog:     slog.NewLogLogger(jsonlog.NewHandler(app.logger), slog.LevelWarn),
+		}
+
+		ln, err := net.Listen("tcp", adminSrv.Addr)
+
+		if err != nil {
+			return err
+		}
+
+		app.logger.PrintInfo("starting admin server", map[string]any{
+			"addr": adminSrv.Addr,
+		})
+
+		go func() {
+			err := adminSrv.Serve(ln)
+
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]any{"addr": adminSrv.Addr})
+			}
+		}()
+	}
+
+	stopPurge := make(chan struct{})
+
+	if app.config.idempotency.purgeInterval > 0 {
+		go app.purgeIdempotencyKeys(app.config.idempotency.purgeInterval, stopPurge)
+	}
+
 	shutDownErr := make(chan error)
 
 	go func() {
@@ -35,21 +80,58 @@ func (app *application) serve() error {
 
 		s := <-quit
 
-		app.logger.PrintInfo("shutting down", map[string]string{
+		app.logger.PrintInfo("shutting down", map[string]any{
 			"signal": s.String(),
 		})
 
+		// From here on the readiness check fails, so that load balancers stop
+		// sending new requests while the ones in flight complete. The server keeps
+		// accepting requests for the drain delay, until they've probed it and
+		// taken it out of rotation.
+		app.shuttingDown.Store(true)
+
+		close(stopPurge)
+
+		if app.config.shutdown.drain > 0 {
+			app.logger.PrintInfo("draining", map[string]any{
+				"delay": app.config.shutdown.drain.String(),
+			})
+
+			time.Sleep(app.config.shutdown.drain)
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
 
 		// Log a message to say that we're waiting for any background goroutines to
 		// complete their tasks.
-		app.logger.PrintInfo("completing background tasks", map[string]string{
+		app.logger.PrintInfo("completing background tasks", map[string]any{
 			"addr": srv.Addr,
 		})
 
 		app.wg.Wait()
-		shutDownErr <- srv.Shutdown(ctx)
+
+		err := srv.Shutdown(ctx)
+
+		if adminSrv != nil {
+			adminSrv.Shutdown(ctx)
+		}
+
+		// Export the spans of the last requests and background tasks.
+		if app.tracer != nil {
+			app.tracer.Shutdown(ctx)
+		}
+
+		// Send the last error reports.
+		if app.errors != nil {
+			app.errors.Shutdown(ctx)
+		}
+
+		if app.access != nil {
+			app.access.Close()
+		}
+
+		shutDownErr <- err
 	}()
 
 	err := srv.ListenAndServe()
@@ -66,7 +148,7 @@ func (app *application) serve() error {
 
 	// At this point we know that the graceful shutdown completed successfully and we
 	// log a "stopped server" message.
-	app.logger.PrintInfo("stopped server", map[string]string{
+	app.logger.PrintInfo("stopped server", map[string]any{
 		"addr": srv.Addr,
 	})
 
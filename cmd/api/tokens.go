@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
@@ -32,11 +33,16 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			app.recordAuditEvent(r, data.AuditEvent{
+				Action:  data.AuditLogin,
+				Outcome: data.AuditFailure,
+				Details: map[string]string{"email": input.Email, "reason": "unknown email"},
+			})
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -52,18 +58,34 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		app.recordAuditEvent(r, data.AuditEvent{
+			Action:    data.AuditLogin,
+			Outcome:   data.AuditFailure,
+			SubjectID: user.ID,
+			Details:   map[string]string{"reason": "wrong password"},
+		})
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 60*time.Minute, data.ScopeAuthentication)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 60*time.Minute, data.ScopeAuthentication)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"authentication_token": token})
+	// A login is the creation of an authentication token, so it stands for the
+	// token.created event too.
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditLogin,
+		Outcome:   data.AuditSuccess,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"scope": data.ScopeAuthentication},
+	})
+
+	err = app.render(w, r, http.StatusOK, envelope{"authentication_token": token})
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -92,7 +114,7 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		return 
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 
 	if err != nil {
 		switch {
@@ -105,17 +127,17 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		return 
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3 * 24 * time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 3 * 24 * time.Hour, data.ScopeActivation)
 
-	app.background(func() {
+	app.background(r.Context(), func(ctx context.Context) {
 		data := map[string]interface{}{
 			"activationToken": token.Plaintext,
 		}
 
-		err := app.mailer.Send(user.Email, "token_activation.tmpl.html", data) 
+		err := app.mailer.Send(ctx, user.Email, "token_activation.tmpl.html", data) 
 
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			app.logger.PrintErrorContext(ctx, err, nil)
 		}
 	})
 
@@ -124,7 +146,14 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	err = app.writeJSON(w, 200, envelope{ "message": "an email will be sent to you containing activation token" })
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditTokenCreated,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+		Details:   map[string]string{"scope": data.ScopeActivation},
+	})
+
+	err = app.render(w, r, 200, envelope{ "message": "an email will be sent to you containing activation token" })
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -152,7 +181,7 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return 
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 
 	if err != nil {
 		switch {
@@ -171,17 +200,17 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 15 * time.Minute, data.ScopePasswordReset)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 15 * time.Minute, data.ScopePasswordReset)
 
-	app.background(func() {
+	app.background(r.Context(), func(ctx context.Context) {
 		data := map[string]interface{}{
 			"passwordResetToken": token.Plaintext,
 		}
 
-		err := app.mailer.Send(user.Email, "password_rest.tmpl.html", data) 
+		err := app.mailer.Send(ctx, user.Email, "password_rest.tmpl.html", data) 
 
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			app.logger.PrintErrorContext(ctx, err, nil)
 		}
 	})
 
@@ -190,7 +219,14 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	err = app.writeJSON(w, 200, envelope{ "message": "an email will be sent to you containing password reset instructions" })
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditTokenCreated,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+		Details:   map[string]string{"scope": data.ScopePasswordReset},
+	})
+
+	err = app.render(w, r, 200, envelope{ "message": "an email will be sent to you containing password reset instructions" })
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
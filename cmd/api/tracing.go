@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/tomasen/realip"
+	"kyawzayarwin.com/greenlight/internal/jsonlog"
+	"kyawzayarwin.com/greenlight/internal/tracing"
+)
+
+// newTracer returns the tracer set up by the -trace-* flags, or nil when tracing
+// is off.
+func newTracer(cfg config, logger *jsonlog.Logger) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+
+	switch cfg.tracing.exporter {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		fileExporter, err := tracing.NewFileExporter(cfg.tracing.file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exporter = fileExporter
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(cfg.tracing.endpoint, nil)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.tracing.exporter)
+	}
+
+	tracer := tracing.New(exporter, tracing.Options{
+		Service: "greenlight",
+		Attributes: map[string]any{
+			"service.version":        version,
+			"deployment.environment": cfg.env,
+		},
+		SampleRatio: cfg.tracing.sampleRatio,
+		OnError: func(err error) {
+			logger.PrintError(err, map[string]any{"exporter": cfg.tracing.exporter})
+		},
+	})
+
+	return tracer, nil
+}
+
+// trace starts the root span of every request. A request with a valid traceparent
+// header continues the caller's trace instead of starting a new one. The
+// traceparent of the root span is sent back, so a client can look its request up.
+func (app *application) trace(next http.Handler) http.Handler {
+	if app.tracer == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if parent, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+
+		ctx, span := app.tracer.Start(ctx, r.Method, tracing.KindServer)
+		defer span.End()
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("user_agent.original", r.UserAgent())
+		span.SetAttribute("client.address", realip.FromRequest(r))
+		span.SetAttribute("request.id", app.ContextGetRequestID(r))
+
+		w.Header().Set("Traceparent", span.SpanContext().Traceparent())
+
+		r = r.WithContext(ctx)
+
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+
+		// The pattern is like "GET /v1/movies/{id}", and the route is its path.
+		if info := app.ContextGetRequestInfo(r); info != nil && info.pattern != "" {
+			span.SetName(info.pattern)
+
+			_, route, _ := strings.Cut(info.pattern, " ")
+			span.SetAttribute("http.route", route)
+		}
+
+		span.SetAttribute("http.response.status_code", metrics.Code)
+
+		if metrics.Code >= 500 {
+			span.SetStatus(tracing.StatusError, http.StatusText(metrics.Code))
+		}
+	})
+}
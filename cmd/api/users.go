@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
@@ -43,7 +44,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	err = app.models.Users.Insert(r.Context(), user)
 
 	if err != nil {
 		switch {
@@ -57,34 +58,42 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	// The grant is recorded in the audit log by AddForUser.
+	err = app.models.Permissions.AddForUser(r.Context(), user.ID, app.auditEvent(r, data.AuditEvent{}), data.PermissionMovieRead)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditTokenCreated,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+		Details:   map[string]string{"scope": data.ScopeActivation},
+	})
+
+	app.background(r.Context(), func(ctx context.Context) {
 		data := map[string]any{
 			"activationToken": token.Plaintext,
 			"userID":          user.ID,
 		}
 
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl.html", data)
+		err = app.mailer.Send(ctx, user.Email, "user_welcome.tmpl.html", data)
 
 		if err != nil {
-			app.logger.PrintError(err, nil)
+			app.logger.PrintErrorContext(ctx, err, nil)
 			return
 		}
 	})
 
-	err = app.writeJSON(w, 200, envelope{"users": user})
+	err = app.render(w, r, 200, envelope{"users": user})
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -110,10 +119,15 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user, err := app.models.Users.GetFromToken(data.ScopeActivation, input.TokenPlainText)
+	user, err := app.models.Users.GetFromToken(r.Context(), data.ScopeActivation, input.TokenPlainText)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			app.recordAuditEvent(r, data.AuditEvent{
+				Action:  data.AuditUserActivated,
+				Outcome: data.AuditFailure,
+				Details: map[string]string{"reason": "invalid or expired token"},
+			})
 			v.AddError("token", "invalid or expired activation token")
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
@@ -124,7 +138,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -135,14 +149,27 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditUserActivated,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+	})
+
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, 200, envelope{"user": user})
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditTokenRevoked,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+		Details:   map[string]string{"scope": data.ScopeActivation},
+	})
+
+	err = app.render(w, r, 200, envelope{"user": user})
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -171,11 +198,16 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return 
 	}
 
-	user, err := app.models.Users.GetFromToken(data.ScopePasswordReset, input.Token);
+	user, err := app.models.Users.GetFromToken(r.Context(), data.ScopePasswordReset, input.Token);
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			app.recordAuditEvent(r, data.AuditEvent{
+				Action:  data.AuditPasswordReset,
+				Outcome: data.AuditFailure,
+				Details: map[string]string{"reason": "invalid or expired token"},
+			})
 			v.AddError("token", "invalid or expired password reset token")
 			app.failedValidationResponse(w, r, v.Errors)
 		default: 
@@ -191,7 +223,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return 
 	}
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 
 	if err != nil {
 		switch {
@@ -203,14 +235,27 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return 
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditPasswordReset,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+	})
+
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopePasswordReset, user.ID)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return 
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{
+	app.recordAuditEvent(r, data.AuditEvent{
+		Action:    data.AuditTokenRevoked,
+		Outcome:   data.AuditSuccess,
+		SubjectID: user.ID,
+		Details:   map[string]string{"scope": data.ScopePasswordReset},
+	})
+
+	err = app.render(w, r, http.StatusOK, envelope{
 		"message": "your password was successfully reset",
 	})
 
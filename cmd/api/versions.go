@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+	"kyawzayarwin.com/greenlight/internal/openapi"
+)
+
+// apiVersion describes one version of the API. Every version is served by the same
+// handlers and models; the mappers translate between a version's JSON and the shape
+// the handlers work with, which is the v1 shape.
+type apiVersion struct {
+	name string
+
+	// deprecation and sunset are sent as the Deprecation (RFC 9745) and Sunset
+	// (RFC 8594) headers on every response of the version, unless they're zero.
+	deprecation time.Time
+	sunset      time.Time
+
+	// spec is the OpenAPI document of the version.
+	spec *openapi.Document
+
+	// movieFields are the movie fields a client can select with ?fields=.
+	movieFields []string
+
+	// mapRequest rewrites a decoded request body into the v1 shape. nil leaves
+	// the body alone.
+	mapRequest func(body map[string]any) error
+
+	// mapResponse converts a value from a response envelope into the version's
+	// representation. nil sends values as they are.
+	mapResponse func(value any) any
+}
+
+var (
+	apiV1 = apiVersion{
+		name:        "v1",
+		spec:        openapi.MustLoad("v1"),
+		movieFields: data.MovieFields,
+	}
+
+	apiV2 = apiVersion{
+		name:        "v2",
+		spec:        openapi.MustLoad("v2"),
+		movieFields: append(slices.Clone(data.MovieFields), "created_at", "updated_at"),
+		mapRequest:  mapRequestV2,
+		mapResponse: mapResponseV2,
+	}
+)
+
+// apiVersions returns every version the API serves, oldest first.
+func (app *application) apiVersions() []apiVersion {
+	v1 := apiV1
+	v1.deprecation = app.config.versions.v1Deprecation
+	v1.sunset = app.config.versions.v1Sunset
+
+	return []apiVersion{v1, apiV2}
+}
+
+// validateVersionDates checks the v1 deprecation and sunset dates. Production
+// requires both, so that v1 clients are always told when it goes away.
+func validateVersionDates(cfg config) error {
+	v1 := cfg.versions
+
+	if cfg.env == "production" && (v1.v1Deprecation.IsZero() || v1.v1Sunset.IsZero()) {
+		return errors.New("-v1-deprecation and -v1-sunset must be set in production")
+	}
+
+	if !v1.v1Deprecation.IsZero() && !v1.v1Sunset.IsZero() && !v1.v1Sunset.After(v1.v1Deprecation) {
+		return errors.New("-v1-sunset must be after -v1-deprecation")
+	}
+
+	return nil
+}
+
+func (version apiVersion) response(value any) any {
+	if version.mapResponse == nil {
+		return value
+	}
+
+	return version.mapResponse(value)
+}
+
+// request runs the request mapper over a JSON body. Bodies that aren't a JSON
+// object are returned unchanged, so that decodeJSON reports what's wrong with them.
+func (version apiVersion) request(body []byte) ([]byte, error) {
+	if version.mapRequest == nil {
+		return body, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var object map[string]any
+
+	if err := dec.Decode(&object); err != nil || object == nil || dec.More() {
+		return body, nil
+	}
+
+	if err := version.mapRequest(object); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(object)
+}
+
+// versioned stores the version in the request context and sends its deprecation
+// headers. Deprecated versions also link to the same resource in the newest version.
+func (app *application) versioned(version apiVersion, latest string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !version.deprecation.IsZero() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", version.deprecation.Unix()))
+
+			successor := "/" + latest + strings.TrimPrefix(r.URL.Path, "/"+version.name)
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		}
+
+		if !version.sunset.IsZero() {
+			w.Header().Set("Sunset", version.sunset.UTC().Format(http.TimeFormat))
+		}
+
+		next.ServeHTTP(w, app.ContextSetVersion(r, version))
+	})
+}
+
+// timestamp is a time that is sent as an RFC 3339 timestamp in UTC with second
+// precision, or null when it isn't known.
+type timestamp time.Time
+
+func (t timestamp) MarshalJSON() ([]byte, error) {
+	if time.Time(t).IsZero() {
+		return []byte("null"), nil
+	}
+
+	return []byte(strconv.Quote(time.Time(t).UTC().Format(time.RFC3339))), nil
+}
+
+// movieV2 is a movie in v2. The runtime is a number of minutes.
+type movieV2 struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   int       `json:"runtime"`
+	Genres    []string  `json:"genres"`
+	Version   int32     `json:"version"`
+	Highlight string    `json:"highlight,omitempty"`
+	CreatedAt timestamp `json:"created_at"`
+	UpdatedAt timestamp `json:"updated_at"`
+}
+
+type userV2 struct {
+	ID        int64     `json:"id"`
+	CreatedAt timestamp `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+	Version   int       `json:"version"`
+}
+
+type tokenV2 struct {
+	Plaintext string    `json:"token"`
+	Expiry    timestamp `json:"expiry"`
+}
+
+func newMovieV2(movie *data.Movie) movieV2 {
+	return movieV2{
+		ID:        movie.ID,
+		Title:     movie.Title,
+		Year:      movie.Year,
+		Runtime:   int(movie.Runtime),
+		Genres:    movie.Genres,
+		Version:   movie.Version,
+		Highlight: movie.Highlight,
+		CreatedAt: timestamp(movie.CreatedAt),
+		UpdatedAt: timestamp(movie.UpdatedAt),
+	}
+}
+
+func mapResponseV2(value any) any {
+	switch v := value.(type) {
+	case *data.Movie:
+		return newMovieV2(v)
+	case []*data.Movie:
+		movies := make([]movieV2, len(v))
+
+		for i := range v {
+			movies[i] = newMovieV2(v[i])
+		}
+
+		return movies
+	case *data.User:
+		return userV2{
+			ID:        v.ID,
+			CreatedAt: timestamp(v.CreatedAt),
+			Name:      v.Name,
+			Email:     v.Email,
+			Activated: v.Activated,
+			Version:   v.Version,
+		}
+	case *data.Token:
+		return tokenV2{
+			Plaintext: v.Plaintext,
+			Expiry:    timestamp(v.Expiry),
+		}
+	default:
+		return value
+	}
+}
+
+// mapRequestV2 converts the runtimes of a v2 request body, either of a movie or of
+// a bulk set_field operation, into the v1 "<n> mins" strings.
+func mapRequestV2(body map[string]any) error {
+	if value, ok := body["runtime"]; ok {
+		runtime, err := runtimeV2(value)
+
+		if err != nil {
+			return err
+		}
+
+		body["runtime"] = runtime
+	}
+
+	if op, ok := body["operation"].(map[string]any); ok && op["field"] == "runtime" {
+		if value, ok := op["value"]; ok {
+			runtime, err := runtimeV2(value)
+
+			if err != nil {
+				return err
+			}
+
+			op["value"] = runtime
+		}
+	}
+
+	return nil
+}
+
+var errInvalidRuntimeV2 = errors.New("runtime must be a whole number of minutes or an ISO 8601 duration like PT1H42M")
+
+// runtimeV2 reads a v2 runtime, given either as a number of minutes or as an
+// ISO 8601 duration. null is passed through, so merge patches can still clear it.
+func runtimeV2(value any) (any, error) {
+	var minutes int64
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		i, err := strconv.ParseInt(v.String(), 10, 32)
+
+		if err != nil {
+			return nil, errInvalidRuntimeV2
+		}
+
+		minutes = i
+	case string:
+		d, err := parseISODuration(v)
+
+		if err != nil || d%time.Minute != 0 {
+			return nil, errInvalidRuntimeV2
+		}
+
+		minutes = int64(d / time.Minute)
+	default:
+		return nil, errInvalidRuntimeV2
+	}
+
+	return fmt.Sprintf("%d mins", minutes), nil
+}
+
+var isoDurationRX = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration parses the day and time parts of an ISO 8601 duration, like
+// PT1H42M or P1DT2H. Years, months and weeks have no fixed length and aren't
+// accepted.
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDurationRX.FindStringSubmatch(s)
+
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+
+	var d time.Duration
+
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(m[i+1], 10, 32)
+
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+		}
+
+		d += time.Duration(n) * unit
+	}
+
+	return d, nil
+}
@@ -0,0 +1,371 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+// The actions recorded in the audit log.
+const (
+	AuditLogin             = "login"
+	AuditTokenCreated      = "token.created"
+	AuditTokenRevoked      = "token.revoked"
+	AuditPasswordReset     = "password.reset"
+	AuditUserActivated     = "user.activated"
+	AuditPermissionGranted = "permission.granted"
+	AuditPermissionRevoked = "permission.revoked"
+	AuditAccessDenied      = "access.denied"
+	AuditDebugAccessed     = "debug.accessed"
+)
+
+var AuditActions = []string{AuditLogin, AuditTokenCreated, AuditTokenRevoked, AuditPasswordReset, AuditUserActivated, AuditPermissionGranted, AuditPermissionRevoked, AuditAccessDenied, AuditDebugAccessed}
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// auditGenesisHash is the previous hash of the first event.
+var auditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// auditChainLock is the key of the advisory lock that events are appended under,
+// one at a time, so that each one chains to the last.
+const auditChainLock = 0x6175646974 // "audit"
+
+// AuditEvent is a security event, like a login. The actor is the user who made the
+// request, and the subject the user it was about, like the owner of the account
+// someone tried to log in to. Either is 0 when there's no such user.
+type AuditEvent struct {
+	ID        int64             `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Action    string            `json:"action"`
+	Outcome   string            `json:"outcome"`
+	ActorID   int64             `json:"actor_id,omitempty"`
+	SubjectID int64             `json:"subject_id,omitempty"`
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	RequestID string            `json:"request_id"`
+	Details   map[string]string `json:"details"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+}
+
+// computeHash hashes the previous hash and every field of the event but its ID,
+// which the database assigns, and its hash.
+func (e *AuditEvent) computeHash() string {
+	details := e.Details
+
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	// The fields of a struct are encoded in order, and the keys of a map sorted,
+	// so the encoding is the same every time.
+	fields, _ := json.Marshal(struct {
+		CreatedAt string
+		Action    string
+		Outcome   string
+		ActorID   int64
+		SubjectID int64
+		IP        string
+		UserAgent string
+		RequestID string
+		Details   map[string]string
+	}{
+		e.CreatedAt.UTC().Format(time.RFC3339Nano), e.Action, e.Outcome, e.ActorID, e.SubjectID,
+		e.IP, e.UserAgent, e.RequestID, details,
+	})
+
+	sum := sha256.Sum256(append([]byte(e.PrevHash), fields...))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditQuery narrows down the events listed. Zero fields match everything.
+type AuditQuery struct {
+	Action    string
+	Outcome   string
+	ActorID   int64
+	SubjectID int64
+	IP        string
+	Since     time.Time
+	Until     time.Time
+}
+
+func ValidateAuditQuery(v *validator.Validator, q AuditQuery) {
+	v.Check(q.Action == "" || validator.In(q.Action, AuditActions...), "action", "must be one of "+strings.Join(AuditActions, ", "))
+	v.Check(q.Outcome == "" || validator.In(q.Outcome, AuditSuccess, AuditFailure), "outcome", "must be success or failure")
+	v.Check(q.ActorID >= 0, "actor_id", "must not be negative")
+	v.Check(q.SubjectID >= 0, "subject_id", "must not be negative")
+	v.Check(q.Since.IsZero() || q.Until.IsZero() || !q.Since.After(q.Until), "since", "must not be after until")
+}
+
+func (q AuditQuery) where(args *sqlArgs) string {
+	conditions := []string{"TRUE"}
+
+	if q.Action != "" {
+		conditions = append(conditions, "action = "+args.add(q.Action))
+	}
+
+	if q.Outcome != "" {
+		conditions = append(conditions, "outcome = "+args.add(q.Outcome))
+	}
+
+	if q.ActorID != 0 {
+		conditions = append(conditions, "actor_id = "+args.add(q.ActorID))
+	}
+
+	if q.SubjectID != 0 {
+		conditions = append(conditions, "subject_id = "+args.add(q.SubjectID))
+	}
+
+	if q.IP != "" {
+		conditions = append(conditions, "ip = "+args.add(q.IP))
+	}
+
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "created_at >= "+args.add(q.Since))
+	}
+
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "created_at < "+args.add(q.Until))
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// AuditVerification is the result of checking the hash chain. FirstInvalidID is
+// the first event whose hash doesn't match, or that doesn't chain to the event
+// before it, which means it or the event before it was tampered with.
+type AuditVerification struct {
+	Valid          bool  `json:"valid"`
+	Events         int64 `json:"events"`
+	FirstInvalidID int64 `json:"first_invalid_id,omitempty"`
+}
+
+type AuditModel struct {
+	DB *DB
+}
+
+const auditColumns = `id, created_at, action, outcome, actor_id, subject_id, ip, user_agent, request_id, details, prev_hash, hash`
+
+// Insert appends the event to the audit log, setting its ID, time and hashes.
+func (m AuditModel) Insert(ctx context.Context, event *AuditEvent) error {
+	ctx, span := startSpan(ctx, "Audit.Insert")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = insertAuditEvent(ctx, tx, event)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	err = tx.Commit()
+
+	span.RecordError(err)
+
+	return err
+}
+
+// insertAuditEvent appends the event within tx, so that models can record an event
+// in the same transaction as the change it's about.
+func insertAuditEvent(ctx context.Context, tx *Tx, event *AuditEvent) error {
+	// The lock is held until the transaction ends, so the next event can't read
+	// the last hash before this one is committed.
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&event.PrevHash)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			event.PrevHash = auditGenesisHash
+		default:
+			return err
+		}
+	}
+
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+
+	// Postgres keeps microseconds.
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.Hash = event.computeHash()
+
+	details, err := json.Marshal(event.Details)
+
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO audit_events (created_at, action, outcome, actor_id, subject_id, ip, user_agent, request_id, details, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`
+
+	args := []any{
+		event.CreatedAt, event.Action, event.Outcome, nullID(event.ActorID), nullID(event.SubjectID),
+		event.IP, event.UserAgent, event.RequestID, details, event.PrevHash, event.Hash,
+	}
+
+	return tx.QueryRowContext(ctx, stmt, args...).Scan(&event.ID)
+}
+
+func (m AuditModel) GetAll(ctx context.Context, query AuditQuery, filters Filters) ([]*AuditEvent, Metadata, error) {
+	ctx, span := startSpan(ctx, "Audit.GetAll")
+	defer span.End()
+
+	args := sqlArgs{}
+
+	where := query.where(&args)
+
+	orderBy := filters.orderBy(func(column, direction string) string {
+		return fmt.Sprintf("%s %s", column, direction)
+	})
+
+	stmt := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM audit_events
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s
+		OFFSET %s`, auditColumns, where, orderBy, args.add(filters.limit()), args.add(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	var totalRecords int
+
+	for rows.Next() {
+		var event AuditEvent
+
+		err := scanAuditEvent(rows, &event, &totalRecords)
+
+		if err != nil {
+			span.RecordError(err)
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, Metadata{}, err
+	}
+
+	return events, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Verify walks the whole chain, recomputing the hash of every event.
+func (m AuditModel) Verify(ctx context.Context) (AuditVerification, error) {
+	ctx, span := startSpan(ctx, "Audit.Verify")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_events ORDER BY id`)
+
+	if err != nil {
+		span.RecordError(err)
+		return AuditVerification{}, err
+	}
+
+	defer rows.Close()
+
+	result := AuditVerification{Valid: true}
+	prevHash := auditGenesisHash
+
+	for rows.Next() {
+		var event AuditEvent
+
+		err := scanAuditEvent(rows, &event)
+
+		if err != nil {
+			span.RecordError(err)
+			return AuditVerification{}, err
+		}
+
+		result.Events++
+
+		if result.Valid && (event.PrevHash != prevHash || event.computeHash() != event.Hash) {
+			result.Valid = false
+			result.FirstInvalidID = event.ID
+		}
+
+		prevHash = event.Hash
+	}
+
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return AuditVerification{}, err
+	}
+
+	return result, nil
+}
+
+// scanAuditEvent scans the auditColumns, after the extra destinations if any.
+func scanAuditEvent(rows *Rows, event *AuditEvent, extra ...any) error {
+	var (
+		actorID, subjectID sql.NullInt64
+		details            []byte
+	)
+
+	dest := append(extra, &event.ID, &event.CreatedAt, &event.Action, &event.Outcome, &actorID, &subjectID,
+		&event.IP, &event.UserAgent, &event.RequestID, &details, &event.PrevHash, &event.Hash)
+
+	err := rows.Scan(dest...)
+
+	if err != nil {
+		return err
+	}
+
+	event.ActorID = actorID.Int64
+	event.SubjectID = subjectID.Int64
+	event.CreatedAt = event.CreatedAt.UTC()
+
+	return json.Unmarshal(details, &event.Details)
+}
+
+// nullID stores an ID of 0, meaning no user, as NULL.
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
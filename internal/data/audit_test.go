@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testAuditEvent() AuditEvent {
+	return AuditEvent{
+		CreatedAt: time.Date(2026, time.October, 18, 21, 38, 7, 123456000, time.UTC),
+		Action:    AuditLogin,
+		Outcome:   AuditFailure,
+		SubjectID: 42,
+		IP:        "203.0.113.7",
+		UserAgent: "curl/8.5.0",
+		RequestID: "b7c9f1d2",
+		Details:   map[string]string{"reason": "wrong password", "email": "alice@example.com"},
+		PrevHash:  auditGenesisHash,
+	}
+}
+
+func TestComputeHashChangesWithEveryField(t *testing.T) {
+	base := testAuditEvent()
+	hash := base.computeHash()
+
+	tests := []struct {
+		name   string
+		change func(e *AuditEvent)
+	}{
+		{"created_at", func(e *AuditEvent) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) }},
+		{"action", func(e *AuditEvent) { e.Action = AuditTokenCreated }},
+		{"outcome", func(e *AuditEvent) { e.Outcome = AuditSuccess }},
+		{"actor_id", func(e *AuditEvent) { e.ActorID = 1 }},
+		{"subject_id", func(e *AuditEvent) { e.SubjectID = 43 }},
+		{"ip", func(e *AuditEvent) { e.IP = "203.0.113.8" }},
+		{"user_agent", func(e *AuditEvent) { e.UserAgent = "curl/8.6.0" }},
+		{"request_id", func(e *AuditEvent) { e.RequestID = "b7c9f1d3" }},
+		{"details", func(e *AuditEvent) { e.Details = map[string]string{"reason": "locked"} }},
+		{"prev_hash", func(e *AuditEvent) { e.PrevHash = hash }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testAuditEvent()
+			tt.change(&e)
+
+			if e.computeHash() == hash {
+				t.Errorf("changing %s doesn't change the hash", tt.name)
+			}
+		})
+	}
+}
+
+// An event read back from Postgres has its time in the session's time zone and
+// its details re-encoded by jsonb, which must hash the same as when it was written.
+func TestComputeHashSurvivesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     func() AuditEvent
+		createdAt func(time.Time) time.Time
+		details   string
+	}{
+		{
+			"other time zone and key order",
+			testAuditEvent,
+			func(t time.Time) time.Time { return t.In(time.FixedZone("MMT", 6*3600+1800)) },
+			`{"email": "alice@example.com", "reason": "wrong password"}`,
+		},
+		{
+			"nil details stored as empty object",
+			func() AuditEvent {
+				e := testAuditEvent()
+				e.Details = nil
+				return e
+			},
+			func(t time.Time) time.Time { return t.Local() },
+			`{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			written := tt.event()
+			hash := written.computeHash()
+
+			read := written
+			read.CreatedAt = tt.createdAt(written.CreatedAt)
+			read.Details = nil
+
+			if err := json.Unmarshal([]byte(tt.details), &read.Details); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := read.computeHash(); got != hash {
+				t.Errorf("hash after round trip = %s, want %s", got, hash)
+			}
+		})
+	}
+}
+
+var auditTestColumns = []string{"id", "created_at", "action", "outcome", "actor_id", "subject_id", "ip", "user_agent", "request_id", "details", "prev_hash", "hash"}
+
+// auditChain returns n chained events as they'd be inserted.
+func auditChain(n int) []AuditEvent {
+	events := make([]AuditEvent, n)
+	prevHash := auditGenesisHash
+
+	for i := range events {
+		e := testAuditEvent()
+		e.ID = int64(i + 1)
+		e.CreatedAt = e.CreatedAt.Add(time.Duration(i) * time.Second)
+		e.Details = map[string]string{"n": string(rune('a' + i))}
+		e.PrevHash = prevHash
+		e.Hash = e.computeHash()
+
+		events[i] = e
+		prevHash = e.Hash
+	}
+
+	return events
+}
+
+// auditRows returns the events as Postgres would send them.
+func auditRows(events []AuditEvent) [][]driver.Value {
+	rows := [][]driver.Value{}
+
+	for _, e := range events {
+		details, _ := json.Marshal(e.Details)
+
+		var subjectID driver.Value
+
+		if e.SubjectID != 0 {
+			subjectID = e.SubjectID
+		}
+
+		rows = append(rows, []driver.Value{
+			e.ID, e.CreatedAt.In(time.FixedZone("EST", -5*3600)), e.Action, e.Outcome, nil, subjectID,
+			e.IP, e.UserAgent, e.RequestID, details, e.PrevHash, e.Hash,
+		})
+	}
+
+	return rows
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(events []AuditEvent) []AuditEvent
+		want   AuditVerification
+	}{
+		{
+			"intact",
+			func(events []AuditEvent) []AuditEvent { return events },
+			AuditVerification{Valid: true, Events: 4},
+		},
+		{
+			"changed field",
+			func(events []AuditEvent) []AuditEvent {
+				events[1].Outcome = AuditSuccess
+				return events
+			},
+			AuditVerification{Valid: false, Events: 4, FirstInvalidID: 2},
+		},
+		{
+			"changed details",
+			func(events []AuditEvent) []AuditEvent {
+				events[2].Details["n"] = "z"
+				return events
+			},
+			AuditVerification{Valid: false, Events: 4, FirstInvalidID: 3},
+		},
+		{
+			"changed field with its hash recomputed",
+			func(events []AuditEvent) []AuditEvent {
+				events[1].IP = "198.51.100.1"
+				events[1].Hash = events[1].computeHash()
+				return events
+			},
+			AuditVerification{Valid: false, Events: 4, FirstInvalidID: 3},
+		},
+		{
+			"removed event",
+			func(events []AuditEvent) []AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			AuditVerification{Valid: false, Events: 3, FirstInvalidID: 3},
+		},
+		{
+			"removed first event",
+			func(events []AuditEvent) []AuditEvent {
+				return events[1:]
+			},
+			AuditVerification{Valid: false, Events: 3, FirstInvalidID: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := tt.tamper(auditChain(4))
+
+			m := AuditModel{DB: newRecordingDB(t, auditTestColumns, auditRows(events)...)}
+
+			got, err := m.Verify(context.Background())
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
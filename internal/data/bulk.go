@@ -0,0 +1,325 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+const (
+	BulkAddGenre    = "add_genre"
+	BulkRemoveGenre = "remove_genre"
+	BulkDelete      = "delete"
+	BulkSetField    = "set_field"
+)
+
+var BulkOperationSafelist = []string{BulkAddGenre, BulkRemoveGenre, BulkDelete, BulkSetField}
+
+// BulkFieldSafelist holds the movie fields a set_field operation may change.
+var BulkFieldSafelist = []string{"title", "year", "runtime"}
+
+// MaxBulkItems caps how many movies a single bulk operation may touch.
+const MaxBulkItems = 1000
+
+var ErrBulkFailed = errors.New("bulk operation failed")
+
+// BulkOperation describes the change applied to every movie of a bulk request.
+// Value holds the new value of Field for set_field: a string for title, an int32 for
+// year and a Runtime for runtime.
+type BulkOperation struct {
+	Type  string
+	Genre string
+	Field string
+	Value any
+}
+
+func ValidateBulkOperation(v *validator.Validator, op BulkOperation) {
+	v.Check(validator.In(op.Type, BulkOperationSafelist...), "operation.type", fmt.Sprintf("must be one of %s", strings.Join(BulkOperationSafelist, ",")))
+
+	switch op.Type {
+	case BulkAddGenre, BulkRemoveGenre:
+		v.Check(op.Genre != "", "operation.genre", "must be provided")
+	case BulkSetField:
+		v.Check(validator.In(op.Field, BulkFieldSafelist...), "operation.field", fmt.Sprintf("must be one of %s", strings.Join(BulkFieldSafelist, ",")))
+		v.Check(op.Value != nil, "operation.value", "must be provided")
+	}
+}
+
+const (
+	BulkStatusUpdated   = "updated"
+	BulkStatusDeleted   = "deleted"
+	BulkStatusUnchanged = "unchanged"
+	BulkStatusNotFound  = "not_found"
+	BulkStatusInvalid   = "invalid"
+)
+
+// BulkResult is the outcome of a bulk operation for a single movie.
+type BulkResult struct {
+	ID     int               `json:"id"`
+	Status string            `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// FindIDs returns the ids of the movies matching query, in id order, stopping after
+// limit ids.
+func (m MovieModel) FindIDs(ctx context.Context, query MovieQuery, limit int) ([]int, error) {
+	ctx, span := startSpan(ctx, "Movies.FindIDs")
+	defer span.End()
+
+	args := sqlArgs{}
+
+	search := query.clauses(&args)
+
+	stmt := fmt.Sprintf(`SELECT m.id FROM movies AS m WHERE %s ORDER BY m.id LIMIT %s`, search.where, args.add(limit))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []int{}
+
+	for rows.Next() {
+		var id int
+
+		if err := rows.Scan(&id); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Bulk applies op to the movies with the given ids in a single transaction. Every
+// changed movie is validated with ValidateMovie first, and if any of them fails
+// nothing is written and ErrBulkFailed is returned along with the per-movie results.
+// With preview set the results are computed the same way but the transaction is
+// always rolled back.
+func (m MovieModel) Bulk(ctx context.Context, ids []int, op BulkOperation, preview bool) ([]BulkResult, error) {
+	ctx, span := startSpan(ctx, "Movies.Bulk")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	movies, err := bulkLoadMovies(ctx, tx, ids)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	results := make([]BulkResult, 0, len(ids))
+	changed := []int64{}
+	failed := false
+
+	for _, id := range ids {
+		movie, found := movies[id]
+
+		if !found {
+			results = append(results, BulkResult{ID: id, Status: BulkStatusNotFound})
+			continue
+		}
+
+		result := applyBulkOperation(movie, op)
+
+		if result.Status == BulkStatusInvalid {
+			failed = true
+		}
+
+		if result.Status == BulkStatusUpdated || result.Status == BulkStatusDeleted {
+			changed = append(changed, int64(id))
+		}
+
+		results = append(results, result)
+	}
+
+	if failed {
+		return results, ErrBulkFailed
+	}
+
+	if preview || len(changed) == 0 {
+		return results, nil
+	}
+
+	err = bulkWrite(ctx, tx, changed, op)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// bulkLoadMovies locks and loads the movies with their genres, keyed by id.
+func bulkLoadMovies(ctx context.Context, tx *Tx, ids []int) (map[int]*Movie, error) {
+	stmt := `SELECT m.id, m.title, m.year, m.runtime, m.version, ARRAY(
+			SELECT g.title FROM movies_genres AS mg
+			INNER JOIN genres AS g ON mg.genre_id = g.id
+			WHERE mg.movie_id = m.id)
+		FROM movies AS m
+		WHERE m.id = ANY($1)
+		ORDER BY m.id
+		FOR UPDATE`
+
+	int64IDs := make([]int64, len(ids))
+
+	for i := range ids {
+		int64IDs[i] = int64(ids[i])
+	}
+
+	rows, err := tx.QueryContext(ctx, stmt, pq.Array(int64IDs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := map[int]*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Runtime, &movie.Version, pq.Array(&movie.Genres))
+
+		if err != nil {
+			return nil, err
+		}
+
+		movies[movie.ID] = &movie
+	}
+
+	return movies, rows.Err()
+}
+
+// applyBulkOperation applies op to the in-memory movie and validates the outcome.
+func applyBulkOperation(movie *Movie, op BulkOperation) BulkResult {
+	result := BulkResult{ID: movie.ID, Status: BulkStatusUpdated}
+
+	switch op.Type {
+	case BulkDelete:
+		result.Status = BulkStatusDeleted
+		return result
+
+	case BulkAddGenre:
+		if slices.Contains(movie.Genres, op.Genre) {
+			result.Status = BulkStatusUnchanged
+			return result
+		}
+		movie.Genres = append(movie.Genres, op.Genre)
+
+	case BulkRemoveGenre:
+		if !slices.Contains(movie.Genres, op.Genre) {
+			result.Status = BulkStatusUnchanged
+			return result
+		}
+		movie.Genres = slices.DeleteFunc(movie.Genres, func(genre string) bool {
+			return genre == op.Genre
+		})
+
+	case BulkSetField:
+		switch op.Field {
+		case "title":
+			movie.Title = op.Value.(string)
+		case "year":
+			movie.Year = op.Value.(int32)
+		case "runtime":
+			movie.Runtime = op.Value.(Runtime)
+		}
+	}
+
+	v := validator.New()
+
+	if ValidateMovie(v, movie); !v.Valid() {
+		result.Status = BulkStatusInvalid
+		result.Errors = v.Errors
+	}
+
+	return result
+}
+
+// bulkWrite writes op for the changed movies with set-based statements, bumping
+// their versions so that clients holding an older copy see an edit conflict.
+func bulkWrite(ctx context.Context, tx *Tx, ids []int64, op BulkOperation) error {
+	var err error
+
+	switch op.Type {
+	case BulkDelete:
+		_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = ANY($1)`, pq.Array(ids))
+		return err
+
+	case BulkAddGenre:
+		var genreID int
+
+		stmt := "INSERT INTO genres (title) VALUES ($1) ON CONFLICT (title) DO UPDATE SET title = EXCLUDED.title RETURNING id;"
+
+		err = tx.QueryRowContext(ctx, stmt, op.Genre).Scan(&genreID)
+
+		if err != nil {
+			return err
+		}
+
+		stmt = `INSERT INTO movies_genres (movie_id, genre_id) SELECT unnest($1::int[]), $2 ON CONFLICT DO NOTHING`
+
+		_, err = tx.ExecContext(ctx, stmt, pq.Array(ids), genreID)
+
+	case BulkRemoveGenre:
+		stmt := `DELETE FROM movies_genres AS mg USING genres AS g
+			WHERE mg.genre_id = g.id AND g.title = $2 AND mg.movie_id = ANY($1)`
+
+		_, err = tx.ExecContext(ctx, stmt, pq.Array(ids), op.Genre)
+
+	case BulkSetField:
+		// The field comes from BulkFieldSafelist, so it's safe to interpolate.
+		if !validator.In(op.Field, BulkFieldSafelist...) {
+			panic("unsafe bulk field: " + op.Field)
+		}
+
+		stmt := fmt.Sprintf(`UPDATE movies SET %s = $2 WHERE id = ANY($1)`, op.Field)
+
+		_, err = tx.ExecContext(ctx, stmt, pq.Array(ids), op.Value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET version = version + 1, updated_at = NOW() WHERE id = ANY($1)`, pq.Array(ids))
+
+	return err
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MovieCache is an in-process LRU cache for movie reads. It holds at most
+// maxEntries results, each for at most ttl.
+type MovieCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	lru        *list.List
+	entries    map[string]*list.Element
+
+	// generation is bumped on every invalidation. A read that started before an
+	// invalidation doesn't store its (possibly stale) result.
+	generation uint64
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+}
+
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func NewMovieCache(maxEntries int, ttl time.Duration) *MovieCache {
+	return &MovieCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached value for key along with the current generation, which
+// has to be passed back to set.
+func (c *MovieCache) get(key string) (any, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.hits.Add(1)
+			return entry.value, c.generation, true
+		}
+
+		c.remove(el)
+	}
+
+	c.misses.Add(1)
+
+	return nil, c.generation, false
+}
+
+func (c *MovieCache) set(key string, value any, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: time.Now().Add(c.ttl)})
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *MovieCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// InvalidateMovie drops the cached movie with the given id and every cached list,
+// since any list may contain the movie or now match it. It's safe to call on a nil
+// cache.
+func (c *MovieCache) InvalidateMovie(id int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.invalidations.Add(1)
+
+	if el, ok := c.entries[movieCacheKey(id)]; ok {
+		c.remove(el)
+	}
+
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, "list:") {
+			c.remove(el)
+		}
+	}
+}
+
+// InvalidateAll empties the cache. It's safe to call on a nil cache.
+func (c *MovieCache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.invalidations.Add(1)
+	c.lru.Init()
+	clear(c.entries)
+}
+
+// Stats returns the cache counters, for publishing with expvar.
+func (c *MovieCache) Stats() map[string]int64 {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return map[string]int64{
+		"hits":          c.hits.Load(),
+		"misses":        c.misses.Load(),
+		"invalidations": c.invalidations.Load(),
+		"entries":       int64(size),
+	}
+}
+
+func movieCacheKey(id int) string {
+	return fmt.Sprintf("movie:%d", id)
+}
+
+// CachedMovieModel serves Get and GetAll from a MovieCache and invalidates it on
+// writes. Base is the model that does the actual work.
+type CachedMovieModel struct {
+	Base  MovieInterface
+	Cache *MovieCache
+}
+
+type cachedMovieList struct {
+	movies   []*Movie
+	metadata Metadata
+}
+
+// copyMovie keeps callers from changing cached movies, as handlers update the movie
+// they got from Get in place.
+func copyMovie(movie *Movie) *Movie {
+	c := *movie
+	c.Genres = append([]string(nil), movie.Genres...)
+	return &c
+}
+
+func copyMovies(movies []*Movie) []*Movie {
+	c := make([]*Movie, len(movies))
+
+	for i := range movies {
+		c[i] = copyMovie(movies[i])
+	}
+
+	return c
+}
+
+func (m CachedMovieModel) Get(ctx context.Context, id int) (*Movie, error) {
+	key := movieCacheKey(id)
+
+	value, generation, ok := m.Cache.get(key)
+
+	if ok {
+		return copyMovie(value.(*Movie)), nil
+	}
+
+	movie, err := m.Base.Get(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.Cache.set(key, copyMovie(movie), generation)
+
+	return movie, nil
+}
+
+func (m CachedMovieModel) GetAll(ctx context.Context, query MovieQuery, filters Filters) ([]*Movie, Metadata, error) {
+	params, err := json.Marshal(struct {
+		Query   MovieQuery
+		Filters Filters
+	}{query, filters})
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	key := "list:" + string(params)
+
+	value, generation, ok := m.Cache.get(key)
+
+	if ok {
+		list := value.(cachedMovieList)
+		return copyMovies(list.movies), list.metadata, nil
+	}
+
+	movies, metadata, err := m.Base.GetAll(ctx, query, filters)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.Cache.set(key, cachedMovieList{movies: copyMovies(movies), metadata: metadata}, generation)
+
+	return movies, metadata, nil
+}
+
+func (m CachedMovieModel) Insert(ctx context.Context, movie *Movie) error {
+	err := m.Base.Insert(ctx, movie)
+	m.Cache.InvalidateMovie(movie.ID)
+	return err
+}
+
+func (m CachedMovieModel) Update(ctx context.Context, movie *Movie) error {
+	err := m.Base.Update(ctx, movie)
+	m.Cache.InvalidateMovie(movie.ID)
+	return err
+}
+
+func (m CachedMovieModel) Delete(ctx context.Context, id int) error {
+	err := m.Base.Delete(ctx, id)
+	m.Cache.InvalidateMovie(id)
+	return err
+}
+
+func (m CachedMovieModel) DeleteVersion(ctx context.Context, id int, version int32) error {
+	err := m.Base.DeleteVersion(ctx, id, version)
+	m.Cache.InvalidateMovie(id)
+	return err
+}
+
+func (m CachedMovieModel) GetFacets(ctx context.Context, query MovieQuery, options FacetOptions) (Facets, error) {
+	return m.Base.GetFacets(ctx, query, options)
+}
+
+func (m CachedMovieModel) FindIDs(ctx context.Context, query MovieQuery, limit int) ([]int, error) {
+	return m.Base.FindIDs(ctx, query, limit)
+}
+
+func (m CachedMovieModel) Bulk(ctx context.Context, ids []int, op BulkOperation, preview bool) ([]BulkResult, error) {
+	results, err := m.Base.Bulk(ctx, ids, op, preview)
+
+	if !preview {
+		m.Cache.InvalidateAll()
+	}
+
+	return results, err
+}
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// QueryStats describes a query once it's done, for DB.OnQuery.
+type QueryStats struct {
+	// Name is the model method that ran the query, like "Movies.Get". A method
+	// running several queries reports them all under its name.
+	Name  string
+	Query string
+	Args  []any
+
+	// Duration runs until the rows of the query were read and closed.
+	Duration time.Duration
+	Rows     int64
+	Err      error
+}
+
+// DB is the database handle of the models. It's a *sql.DB that reports every query
+// to OnQuery, so that queries can be measured and logged in one place.
+type DB struct {
+	*sql.DB
+
+	// OnQuery, if set, is called after every query with the context it ran with.
+	OnQuery func(ctx context.Context, stats QueryStats)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execContext(ctx, db, db.DB, query, args)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	return queryContext(ctx, db, db.DB, query, args)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return queryRowContext(ctx, db, db.DB, query, args)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+// Tx is a transaction whose queries are reported like those of the DB it was begun
+// on.
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execContext(ctx, tx.db, tx.Tx, query, args)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	return queryContext(ctx, tx.db, tx.Tx, query, args)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return queryRowContext(ctx, tx.db, tx.Tx, query, args)
+}
+
+// queryer is what *sql.DB and *sql.Tx have in common.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// query is a query in progress, reported when it's done.
+type query struct {
+	ctx   context.Context
+	db    *DB
+	stats QueryStats
+	start time.Time
+}
+
+func startQuery(ctx context.Context, db *DB, stmt string, args []any) *query {
+	name, _ := ctx.Value(queryNameContextKey{}).(string)
+
+	if name == "" {
+		name = "unnamed"
+	}
+
+	return &query{
+		ctx:   ctx,
+		db:    db,
+		stats: QueryStats{Name: name, Query: stmt, Args: args},
+		start: time.Now(),
+	}
+}
+
+func (q *query) done(rows int64, err error) {
+	if q.db.OnQuery == nil {
+		return
+	}
+
+	q.stats.Duration = time.Since(q.start)
+	q.stats.Rows = rows
+
+	// Not finding a row is an answer, not a failure.
+	if !errors.Is(err, sql.ErrNoRows) {
+		q.stats.Err = err
+	}
+
+	q.db.OnQuery(q.ctx, q.stats)
+}
+
+func execContext(ctx context.Context, db *DB, conn queryer, stmt string, args []any) (sql.Result, error) {
+	q := startQuery(ctx, db, stmt, args)
+
+	result, err := conn.ExecContext(ctx, stmt, args...)
+
+	var affected int64
+
+	if err == nil {
+		// Not every statement reports the rows it affected, so the error is
+		// ignored here.
+		affected, _ = result.RowsAffected()
+	}
+
+	q.done(affected, err)
+
+	return result, err
+}
+
+func queryContext(ctx context.Context, db *DB, conn queryer, stmt string, args []any) (*Rows, error) {
+	q := startQuery(ctx, db, stmt, args)
+
+	rows, err := conn.QueryContext(ctx, stmt, args...)
+
+	if err != nil {
+		q.done(0, err)
+		return nil, err
+	}
+
+	return &Rows{Rows: rows, query: q}, nil
+}
+
+func queryRowContext(ctx context.Context, db *DB, conn queryer, stmt string, args []any) *Row {
+	q := startQuery(ctx, db, stmt, args)
+
+	return &Row{Row: conn.QueryRowContext(ctx, stmt, args...), query: q}
+}
+
+// Rows counts the rows read, and reports the query when it's closed.
+type Rows struct {
+	*sql.Rows
+	query  *query
+	count  int64
+	closed bool
+}
+
+func (r *Rows) Next() bool {
+	if !r.Rows.Next() {
+		return false
+	}
+
+	r.count++
+
+	return true
+}
+
+func (r *Rows) Close() error {
+	queryErr := r.Rows.Err()
+
+	err := r.Rows.Close()
+
+	if !r.closed {
+		r.closed = true
+
+		if queryErr == nil {
+			queryErr = err
+		}
+
+		r.query.done(r.count, queryErr)
+	}
+
+	return err
+}
+
+// Row reports the query when it's scanned.
+type Row struct {
+	*sql.Row
+	query *query
+}
+
+func (r *Row) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+
+	var rows int64
+
+	if err == nil {
+		rows = 1
+	}
+
+	r.query.done(rows, err)
+
+	return err
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// recordingDriver is a database/sql driver that runs nothing. It records the
+// statements executed through it, and answers queries with its rows.
+type recordingDriver struct {
+	mu    sync.Mutex
+	execs []recordedExec
+
+	columns []string
+	rows    [][]driver.Value
+}
+
+type recordedExec struct {
+	query string
+	args  []any
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("recordingConn: Prepare isn't supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("recordingConn: Begin isn't supported")
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	exec := recordedExec{query: query}
+
+	for _, arg := range args {
+		exec.args = append(exec.args, arg.Value)
+	}
+
+	c.driver.mu.Lock()
+	c.driver.execs = append(c.driver.execs, exec)
+	c.driver.mu.Unlock()
+
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	return &recordingRows{columns: c.driver.columns, rows: c.driver.rows}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recordingRows) Close() error {
+	return nil
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", recorder)
+}
+
+// newRecordingDB returns a DB on the recording driver, which answers queries with
+// rows of the columns.
+func newRecordingDB(t *testing.T, columns []string, rows ...[]driver.Value) *DB {
+	t.Helper()
+
+	recorder.mu.Lock()
+	recorder.columns = columns
+	recorder.rows = rows
+	recorder.mu.Unlock()
+
+	db, err := sql.Open("recording", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+
+		recorder.mu.Lock()
+		recorder.execs = nil
+		recorder.columns = nil
+		recorder.rows = nil
+		recorder.mu.Unlock()
+	})
+
+	return &DB{DB: db}
+}
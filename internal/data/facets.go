@@ -0,0 +1,164 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+const (
+	FacetGenres  = "genres"
+	FacetYears   = "years"
+	FacetRuntime = "runtime"
+)
+
+var FacetSafelist = []string{FacetGenres, FacetYears, FacetRuntime}
+
+var YearIntervalSafelist = []string{"decade", "year"}
+
+// FacetOptions selects which facets are computed and how years are grouped.
+type FacetOptions struct {
+	Facets       []string
+	YearInterval string
+}
+
+func (o FacetOptions) Include(facet string) bool {
+	return validator.In(facet, o.Facets...)
+}
+
+func ValidateFacetOptions(v *validator.Validator, o FacetOptions) {
+	for _, facet := range o.Facets {
+		v.Check(validator.In(facet, FacetSafelist...), "facets", fmt.Sprintf("invalid facet, must be one of %s", strings.Join(FacetSafelist, ",")))
+	}
+
+	v.Check(validator.Unique(o.Facets), "facets", "must not contain duplicate values")
+	v.Check(validator.In(o.YearInterval, YearIntervalSafelist...), "facet_year_interval", fmt.Sprintf("invalid interval, must be one of %s", strings.Join(YearIntervalSafelist, ",")))
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets holds the number of movies per genre, year (or decade) and runtime bucket
+// across the whole filtered result set, not only the current page.
+type Facets struct {
+	Genres  []FacetCount `json:"genres,omitempty"`
+	Years   []FacetCount `json:"years,omitempty"`
+	Runtime []FacetCount `json:"runtime,omitempty"`
+}
+
+// runtimeBuckets is the CASE expression that sorts movies into runtime buckets. The
+// bucket number is used to keep the buckets in order in the response.
+const runtimeBuckets = `CASE
+			WHEN f.runtime < 90 THEN 1
+			WHEN f.runtime < 120 THEN 2
+			WHEN f.runtime < 150 THEN 3
+			ELSE 4
+		END`
+
+var runtimeBucketLabels = map[int]string{
+	1: "0-89",
+	2: "90-119",
+	3: "120-149",
+	4: "150+",
+}
+
+func (m MovieModel) GetFacets(ctx context.Context, query MovieQuery, options FacetOptions) (Facets, error) {
+	ctx, span := startSpan(ctx, "Movies.GetFacets")
+	defer span.End()
+
+	facets := Facets{}
+
+	if len(options.Facets) == 0 {
+		return facets, nil
+	}
+
+	args := sqlArgs{}
+
+	search := query.clauses(&args)
+
+	// Every facet is computed with a single round trip: the filtered movies are
+	// collected once and each facet contributes (facet, value, position, count)
+	// rows to a UNION ALL.
+	selects := []string{}
+
+	if options.Include(FacetGenres) {
+		selects = append(selects, `SELECT 'genres', g.title, 0, count(*) FROM filtered AS f
+		INNER JOIN movies_genres AS mg ON mg.movie_id = f.id
+		INNER JOIN genres AS g ON mg.genre_id = g.id
+		GROUP BY g.title`)
+	}
+
+	if options.Include(FacetYears) {
+		year := "f.year"
+
+		if options.YearInterval == "decade" {
+			year = "f.year / 10 * 10"
+		}
+
+		selects = append(selects, fmt.Sprintf(`SELECT 'years', (%s)::text, %s, count(*) FROM filtered AS f
+		GROUP BY %s`, year, year, year))
+	}
+
+	if options.Include(FacetRuntime) {
+		selects = append(selects, fmt.Sprintf(`SELECT 'runtime', '', %s, count(*) FROM filtered AS f
+		GROUP BY 3`, runtimeBuckets))
+	}
+
+	stmt := fmt.Sprintf(`WITH filtered AS (
+			SELECT m.id, m.year, m.runtime FROM movies AS m WHERE %s
+		)
+		%s
+		ORDER BY 1, 3, 4 DESC, 2;`, search.where, strings.Join(selects, "\n\t\tUNION ALL\n\t\t"))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+
+	if err != nil {
+		span.RecordError(err)
+		return Facets{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			facet    string
+			count    FacetCount
+			position int
+		)
+
+		err := rows.Scan(&facet, &count.Value, &position, &count.Count)
+
+		if err != nil {
+			span.RecordError(err)
+			return Facets{}, err
+		}
+
+		switch facet {
+		case FacetGenres:
+			facets.Genres = append(facets.Genres, count)
+		case FacetYears:
+			if options.YearInterval == "decade" {
+				count.Value += "s"
+			}
+			facets.Years = append(facets.Years, count)
+		case FacetRuntime:
+			count.Value = runtimeBucketLabels[position]
+			facets.Runtime = append(facets.Runtime, count)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return Facets{}, err
+	}
+
+	return facets, nil
+}
@@ -21,25 +21,58 @@ func ValidateFilter(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", fmt.Sprintf("invalid sort value, must be one of %s", strings.Join(f.SortSafelist, ",")))
+	columns := []string{}
+
+	for _, sort := range f.sortValues() {
+		v.Check(validator.In(sort, f.SortSafelist...), "sort", fmt.Sprintf("invalid sort value, must be a comma separated list of %s", strings.Join(f.SortSafelist, ",")))
+		columns = append(columns, strings.TrimPrefix(sort, "-"))
+	}
+
+	v.Check(validator.Unique(columns), "sort", "must not sort by the same column twice")
 }
 
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
-		}
+// sortValues splits a sort like "-year,title" into its components.
+func (f Filters) sortValues() []string {
+	values := strings.Split(f.Sort, ",")
+
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
 	}
 
-	panic("unsafe sort parameter: " + f.Sort)
+	return values
 }
 
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+// orderBy builds an ORDER BY list from the sort components, calling term with each
+// column and its direction (ASC or DESC) to render it. An ascending id is appended
+// as a tie-breaker unless the client already sorted by id, so rows with equal sort
+// values always come back in the same order and pagination stays deterministic.
+func (f Filters) orderBy(term func(column, direction string) string) string {
+	terms := []string{}
+	sortedByID := false
+
+	for _, sort := range f.sortValues() {
+		if !validator.In(sort, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + sort)
+		}
+
+		column, direction := strings.TrimPrefix(sort, "-"), "ASC"
+
+		if strings.HasPrefix(sort, "-") {
+			direction = "DESC"
+		}
+
+		if column == "id" {
+			sortedByID = true
+		}
+
+		terms = append(terms, term(column, direction))
+	}
+
+	if !sortedByID {
+		terms = append(terms, term("id", "ASC"))
 	}
 
-	return "ASC"
+	return strings.Join(terms, ", ")
 }
 
 func (f Filters) limit() int {
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 )
 
@@ -10,13 +11,16 @@ type Genre struct {
 }
 
 type GenreModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (g GenreModel) Insert(genre *Genre) error {
+func (g GenreModel) Insert(ctx context.Context, genre *Genre) error {
+	ctx, span := startSpan(ctx, "Genres.Insert")
+	defer span.End()
+
 	stmt := "INSERT INTO genres (title) VALUES ($1) ON CONFLICT (title) DO UPDATE SET title = EXCLUDED.title RETURNING id;"
 
-	row := g.DB.QueryRow(stmt, genre.Title)
+	row := g.DB.QueryRowContext(ctx, stmt, genre.Title)
 
 	err := row.Scan(&genre.ID)
 
@@ -24,22 +28,23 @@ func (g GenreModel) Insert(genre *Genre) error {
 		if err == sql.ErrNoRows {
 			return nil
 		}
+		span.RecordError(err)
 		return err
 	}
 
 	return nil
 }
 
-func (g GenreModel) Update(genre Genre) error {
+func (g GenreModel) Update(ctx context.Context, genre Genre) error {
 	// Won't Implement
 	return nil
 }
 
-func (g GenreModel) Get(id int) (*Genre, error) {
+func (g GenreModel) Get(ctx context.Context, id int) (*Genre, error) {
 	// Won't Implement
 	return nil, nil
 }
 
-func (g GenreModel) Delete(id int) error {
+func (g GenreModel) Delete(ctx context.Context, id int) error {
 	return nil
 }
@@ -0,0 +1,177 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyInProgress = errors.New("idempotency key in progress")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused")
+)
+
+// IdempotentResponse is the stored response of the first request made with an
+// idempotency key, which is replayed for every retry.
+type IdempotentResponse struct {
+	Status  int
+	Headers http.Header
+	Body    []byte
+}
+
+type IdempotencyModel struct {
+	DB *DB
+}
+
+// Reserve claims the key for the user. It returns a nil response when the key is
+// new and the request should go ahead, or the stored response when the request has
+// already completed. ErrIdempotencyKeyInProgress means that an earlier request with
+// the key is still running, and ErrIdempotencyKeyReused that the key was used for a
+// different request.
+func (m IdempotencyModel) Reserve(ctx context.Context, key string, userID int64, requestHash []byte, ttl time.Duration) (*IdempotentResponse, error) {
+	ctx, span := startSpan(ctx, "Idempotency.Reserve")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Expired keys can be used again, as if they were never seen.
+	stmt := `DELETE FROM idempotency_keys WHERE key = $1 AND user_id = $2 AND expiry < NOW()`
+
+	_, err := m.DB.ExecContext(ctx, stmt, key, userID)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	stmt = `
+		INSERT INTO idempotency_keys (key, user_id, request_hash, expiry)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key, user_id) DO NOTHING`
+
+	result, err := m.DB.ExecContext(ctx, stmt, key, userID, requestHash, time.Now().Add(ttl))
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	inserted, err := result.RowsAffected()
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	stmt = `SELECT request_hash, status, headers, body FROM idempotency_keys WHERE key = $1 AND user_id = $2`
+
+	var (
+		storedHash []byte
+		status     sql.NullInt32
+		headers    []byte
+		response   IdempotentResponse
+	)
+
+	err = m.DB.QueryRowContext(ctx, stmt, key, userID).Scan(&storedHash, &status, &headers, &response.Body)
+
+	if err != nil {
+		switch {
+		// The key was released between the insert and the select because the
+		// request holding it failed. Let the client retry as if it were running.
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrIdempotencyKeyInProgress
+		default:
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	if !bytes.Equal(storedHash, requestHash) {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	if !status.Valid {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	response.Status = int(status.Int32)
+
+	err = json.Unmarshal(headers, &response.Headers)
+
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Complete stores the response of the request that reserved the key.
+func (m IdempotencyModel) Complete(ctx context.Context, key string, userID int64, response IdempotentResponse) error {
+	ctx, span := startSpan(ctx, "Idempotency.Complete")
+	defer span.End()
+
+	headers, err := json.Marshal(response.Headers)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	stmt := `UPDATE idempotency_keys SET status = $3, headers = $4, body = $5 WHERE key = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, stmt, key, userID, response.Status, headers, response.Body)
+
+	span.RecordError(err)
+
+	return err
+}
+
+// Release forgets a reserved key, so a failed request can be retried with it.
+func (m IdempotencyModel) Release(ctx context.Context, key string, userID int64) error {
+	ctx, span := startSpan(ctx, "Idempotency.Release")
+	defer span.End()
+
+	stmt := `DELETE FROM idempotency_keys WHERE key = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, key, userID)
+
+	span.RecordError(err)
+
+	return err
+}
+
+// PurgeExpired deletes the expired keys and returns how many there were.
+func (m IdempotencyModel) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "Idempotency.PurgeExpired")
+	defer span.End()
+
+	stmt := `DELETE FROM idempotency_keys WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt)
+
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
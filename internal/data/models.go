@@ -1,8 +1,10 @@
 package data
 
 import (
-	"database/sql"
+	"context"
 	"errors"
+
+	"kyawzayarwin.com/greenlight/internal/tracing"
 )
 
 var (
@@ -13,21 +15,36 @@ var (
 
 type Models struct {
 	Movies       MovieInterface
+	MovieCache   *MovieCache
 	Genres       GenreModel
 	MoviesGenres MoviesGenresModel
 	Users        UserModel
 	Tokens       TokenModel
 	Permissions  PermissionModel
+	Idempotency  IdempotencyModel
+	Schema       SchemaModel
+	Audit        AuditModel
 }
 
-func NewModels(db *sql.DB) Models {
+// NewModels wires up the models. Movie reads go through the cache unless it is nil.
+func NewModels(db *DB, cache *MovieCache) Models {
+	var movies MovieInterface = MovieModel{DB: db}
+
+	if cache != nil {
+		movies = CachedMovieModel{Base: movies, Cache: cache}
+	}
+
 	return Models{
-		Movies:       MovieModel{DB: db},
+		Movies:       movies,
+		MovieCache:   cache,
 		Genres:       GenreModel{DB: db},
-		MoviesGenres: MoviesGenresModel{DB: db},
+		MoviesGenres: MoviesGenresModel{DB: db, Cache: cache},
 		Users:        UserModel{DB: db},
 		Tokens:       TokenModel{DB: db},
 		Permissions:  PermissionModel{DB: db},
+		Idempotency:  IdempotencyModel{DB: db},
+		Schema:       SchemaModel{DB: db},
+		Audit:        AuditModel{DB: db},
 	}
 }
 
@@ -36,3 +53,18 @@ func NewMockModel() Models {
 		Movies: MockMovieModel{},
 	}
 }
+
+// queryNameContextKey holds the name of the model method running, which the DB
+// reports its queries under.
+type queryNameContextKey struct{}
+
+// startSpan starts the span of a model method, named like "Movies.Get", as a child
+// of the span in ctx. Without one it returns a nil span, whose methods do nothing.
+// The name is also what the method's queries are reported under.
+func startSpan(ctx context.Context, name string) (context.Context, *tracing.Span) {
+	ctx = context.WithValue(ctx, queryNameContextKey{}, name)
+
+	ctx, span := tracing.Start(ctx, name)
+	span.SetAttribute("db.system", "postgresql")
+	return ctx, span
+}
@@ -14,19 +14,27 @@ import (
 type Movie struct {
 	ID        int       `json:"id"`
 	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
 	Title     string    `json:"title"`
 	Year      int32     `json:"year"`
 	Runtime   Runtime   `json:"runtime"`
 	Genres    []string  `json:"genres"`
 	Version   int32     `json:"version"`
+	Highlight string    `json:"highlight,omitempty"`
 	// the visibility of individual struct fields in the JSON by using the omitempty and - struct tag directives.
 }
 
+// MovieFields are the fields of a movie a client can select with ?fields=.
+var MovieFields = []string{"id", "title", "year", "runtime", "genres", "version", "highlight"}
+
+// MovieIncludes are the related resources a client can opt into with ?include=.
+var MovieIncludes = []string{"genres"}
+
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
+	v.Check(movie.Year >= 1888, "year", "must be 1888 or later")
 	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
 	v.Check(movie.Runtime != 0, "runtime", "must be provided")
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
@@ -38,38 +46,52 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
 type MovieInterface interface {
-	Insert(movie *Movie) error
-	Get(id int) (*Movie, error)
-	Update(movie *Movie) error
-	Delete(id int) error
-	GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+	Insert(ctx context.Context, movie *Movie) error
+	Get(ctx context.Context, id int) (*Movie, error)
+	Update(ctx context.Context, movie *Movie) error
+	Delete(ctx context.Context, id int) error
+	DeleteVersion(ctx context.Context, id int, version int32) error
+	GetAll(ctx context.Context, query MovieQuery, filters Filters) ([]*Movie, Metadata, error)
+	GetFacets(ctx context.Context, query MovieQuery, options FacetOptions) (Facets, error)
+	FindIDs(ctx context.Context, query MovieQuery, limit int) ([]int, error)
+	Bulk(ctx context.Context, ids []int, op BulkOperation, preview bool) ([]BulkResult, error)
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
-	stmt := `INSERT INTO movies (title, year, runtime) VALUES($1, $2, $3) RETURNING id, created_at, version;`
+func (m MovieModel) Insert(ctx context.Context, movie *Movie) error {
+	ctx, span := startSpan(ctx, "Movies.Insert")
+	defer span.End()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	stmt := `INSERT INTO movies (title, year, runtime) VALUES($1, $2, $3) RETURNING id, created_at, updated_at, version;`
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, stmt, movie.Title, movie.Year, movie.Runtime).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err := m.DB.QueryRowContext(ctx, stmt, movie.Title, movie.Year, movie.Runtime).Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Version)
+
+	span.RecordError(err)
+
+	return err
 }
 
-func (m MovieModel) Get(id int) (*Movie, error) {
+func (m MovieModel) Get(ctx context.Context, id int) (*Movie, error) {
+	ctx, span := startSpan(ctx, "Movies.Get")
+	defer span.End()
+
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	stmt := `SELECT m.id, m.title, m.year, m.runtime, m.version, ARRAY_AGG(g.title) as "genre_title" FROM public."movies" as m
+	stmt := `SELECT m.id, m.created_at, m.updated_at, m.title, m.year, m.runtime, m.version, ARRAY_AGG(g.title) as "genre_title" FROM public."movies" as m
 		LEFT JOIN movies_genres as mg ON m.id = mg.movie_id
 		LEFT JOIN genres as g ON mg.genre_id = g.id
 		WHERE m.id = $1
 		GROUP BY m.id,  m.title, m.year, m.runtime, m.version;`
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, stmt, id)
@@ -77,7 +99,7 @@ func (m MovieModel) Get(id int) (*Movie, error) {
 	movie := &Movie{}
 
 	var genreTitles []sql.NullString
-	err := row.Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Runtime, &movie.Version, pq.Array(&genreTitles))
+	err := row.Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Version, pq.Array(&genreTitles))
 
 	genres := []string{}
 	for _, g := range genreTitles {
@@ -92,27 +114,32 @@ func (m MovieModel) Get(id int) (*Movie, error) {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
+		span.RecordError(err)
 		return nil, err
 	}
 
 	return movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
-	stmt := "UPDATE movies SET title = $2, year = $3, runtime = $4, version = version + 1 WHERE id = $1 AND version = $5 RETURNING version"
+func (m MovieModel) Update(ctx context.Context, movie *Movie) error {
+	ctx, span := startSpan(ctx, "Movies.Update")
+	defer span.End()
+
+	stmt := "UPDATE movies SET title = $2, year = $3, runtime = $4, version = version + 1, updated_at = NOW() WHERE id = $1 AND version = $5 RETURNING version, updated_at"
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, stmt, movie.ID, movie.Title, movie.Year, movie.Runtime, movie.Version)
 
-	err := row.Scan(&movie.Version)
+	err := row.Scan(&movie.Version, &movie.UpdatedAt)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
+			span.RecordError(err)
 			return err
 		}
 	}
@@ -120,21 +147,26 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m MovieModel) Delete(id int) error {
+func (m MovieModel) Delete(ctx context.Context, id int) error {
+	ctx, span := startSpan(ctx, "Movies.Delete")
+	defer span.End()
+
 	stmt := "DELETE FROM movies WHERE id = $1;"
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, stmt, id)
 
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
 	rowsAffected, err := result.RowsAffected()
 
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
@@ -145,28 +177,85 @@ func (m MovieModel) Delete(id int) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	stmt := fmt.Sprintf(`SELECT count(*) OVER(), m.id, m.title, m.year, m.runtime, m.version, ARRAY_AGG(g.title) as "genre_title" FROM public."movies" as m
-		LEFT JOIN movies_genres as mg ON m.id = mg.movie_id
-		LEFT JOIN genres as g ON mg.genre_id = g.id
-		WHERE (to_tsvector('simple', m.title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-		GROUP BY m.id,  m.title, m.year, m.runtime, m.version
-		HAVING ($2 <@ ARRAY_AGG(g.title) OR $2= '{}')
-		ORDER BY m.%s %s
-		LIMIT $3
-		OFFSET $4;`, filters.sortColumn(), filters.sortDirection())
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+// DeleteVersion deletes the movie only while it's still at the given version,
+// returning ErrEditConflict when it has been changed (or deleted) in the meantime.
+func (m MovieModel) DeleteVersion(ctx context.Context, id int, version int32) error {
+	ctx, span := startSpan(ctx, "Movies.DeleteVersion")
+	defer span.End()
+
+	stmt := "DELETE FROM movies WHERE id = $1 AND version = $2;"
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	result, err := m.DB.ExecContext(ctx, stmt, id, version)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (m MovieModel) GetAll(ctx context.Context, query MovieQuery, filters Filters) ([]*Movie, Metadata, error) {
+	ctx, span := startSpan(ctx, "Movies.GetAll")
+	defer span.End()
+
+	args := sqlArgs{}
+
+	search := query.clauses(&args)
+
+	orderBy := filters.orderBy(func(column, direction string) string {
+		// Relevance always puts the best matches first.
+		if column == SortRelevance {
+			return "rank DESC"
+		}
+
+		return fmt.Sprintf("m.%s %s", column, direction)
+	})
+
+	genreTitles, joins, groupBy := "'{}'::text[]", "", ""
+
+	if query.IncludeGenres {
+		genreTitles = "ARRAY_AGG(g.title)"
+		joins = `LEFT JOIN movies_genres as mg ON m.id = mg.movie_id
+		LEFT JOIN genres as g ON mg.genre_id = g.id`
+		groupBy = "GROUP BY m.id,  m.created_at, m.updated_at, m.title, m.year, m.runtime, m.version"
+	}
+
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), m.id, m.created_at, m.updated_at, m.title, m.year, m.runtime, m.version, %s as "genre_title",
+		%s AS rank, %s AS highlight FROM public."movies" as m
+		%s
+		WHERE %s
+		%s
+		ORDER BY %s
+		LIMIT %s
+		OFFSET %s;`, genreTitles, search.rank, search.highlight, joins, search.where, groupBy, orderBy, args.add(filters.limit()), args.add(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
 
 	row, err := m.DB.QueryContext(ctx, stmt, args...)
 
 	if err != nil {
+		span.RecordError(err)
 		return nil, Metadata{}, err
 	}
 
+	defer row.Close()
+
 	movies := []*Movie{}
 	var totalRecords int
 
@@ -174,8 +263,9 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		var movie Movie
 
 		var genreTitles []sql.NullString
+		var rank float64
 
-		err := row.Scan(&totalRecords, &movie.ID, &movie.Title, &movie.Year, &movie.Runtime, &movie.Version, pq.Array(&genreTitles))
+		err := row.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.UpdatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Version, pq.Array(&genreTitles), &rank, &movie.Highlight)
 
 		genres := []string{}
 		for _, g := range genreTitles {
@@ -187,6 +277,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		movie.Genres = genres
 
 		if err != nil {
+			span.RecordError(err)
 			return nil, Metadata{}, err
 		}
 
@@ -196,6 +287,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
 	if err = row.Err(); err != nil {
+		span.RecordError(err)
 		return nil, Metadata{}, err
 	}
 
@@ -204,21 +296,37 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 type MockMovieModel struct{}
 
-func (m MockMovieModel) Insert(movie *Movie) error {
+func (m MockMovieModel) Insert(ctx context.Context, movie *Movie) error {
 	// Mock the action...
 	return nil
 }
-func (m MockMovieModel) Get(id int) (*Movie, error) {
+func (m MockMovieModel) Get(ctx context.Context, id int) (*Movie, error) {
 	return nil, nil
 }
-func (m MockMovieModel) Update(movie *Movie) error {
+func (m MockMovieModel) Update(ctx context.Context, movie *Movie) error {
 	return nil
 }
 
-func (m MockMovieModel) Delete(id int) error {
+func (m MockMovieModel) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MockMovieModel) DeleteVersion(ctx context.Context, id int, version int32) error {
+	return nil
+}
+
+func (m MockMovieModel) GetAll(ctx context.Context, query MovieQuery, filters Filters) ([]*Movie, Metadata, error) {
 	return nil, Metadata{}, nil
 }
+
+func (m MockMovieModel) GetFacets(ctx context.Context, query MovieQuery, options FacetOptions) (Facets, error) {
+	return Facets{}, nil
+}
+
+func (m MockMovieModel) FindIDs(ctx context.Context, query MovieQuery, limit int) ([]int, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Bulk(ctx context.Context, ids []int, op BulkOperation, preview bool) ([]BulkResult, error) {
+	return nil, nil
+}
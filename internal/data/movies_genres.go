@@ -1,7 +1,7 @@
 package data
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -12,39 +12,58 @@ type MoviesGenres struct {
 }
 
 type MoviesGenresModel struct {
-	DB *sql.DB
+	DB    *DB
+	Cache *MovieCache
 }
 
-func (mg MoviesGenresModel) AddMovieToGenre(moviesGenres MoviesGenres) error {
+func (mg MoviesGenresModel) AddMovieToGenre(ctx context.Context, moviesGenres MoviesGenres) error {
+	ctx, span := startSpan(ctx, "MoviesGenres.AddMovieToGenre")
+	defer span.End()
+
 	stmt := "INSERT INTO movies_genres (movie_id, genre_id) VALUES ($1, $2);"
 
-	_, err := mg.DB.Exec(stmt, moviesGenres.MovieID, moviesGenres.GenreID)
+	_, err := mg.DB.ExecContext(ctx, stmt, moviesGenres.MovieID, moviesGenres.GenreID)
+
+	mg.Cache.InvalidateMovie(moviesGenres.MovieID)
 
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
 	return nil
 }
 
-func (mg MoviesGenresModel) DeleteMovieFromGenre(moviesGenres MoviesGenres) error {
+func (mg MoviesGenresModel) DeleteMovieFromGenre(ctx context.Context, moviesGenres MoviesGenres) error {
+	ctx, span := startSpan(ctx, "MoviesGenres.DeleteMovieFromGenre")
+	defer span.End()
+
 	stmt := "DELETE FROM movies_genres WHERE movie_id = $1 AND genre_id = $2;"
 
-	_, err := mg.DB.Exec(stmt, moviesGenres.MovieID, moviesGenres.GenreID)
+	_, err := mg.DB.ExecContext(ctx, stmt, moviesGenres.MovieID, moviesGenres.GenreID)
+
+	mg.Cache.InvalidateMovie(moviesGenres.MovieID)
 
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
 	return nil
 }
 
-func (mg MoviesGenresModel) BulkUpdateMoviesFromGenre(movieID int, moviesGenres []MoviesGenres) error {
+func (mg MoviesGenresModel) BulkUpdateMoviesFromGenre(ctx context.Context, movieID int, moviesGenres []MoviesGenres) error {
+	ctx, span := startSpan(ctx, "MoviesGenres.BulkUpdateMoviesFromGenre")
+	defer span.End()
+
 	if len(moviesGenres) < 1 {
 		stmt := `DELETE FROM movies_genres WHERE movie_id = $1;`
-		_, err := mg.DB.Exec(stmt, movieID)
+		_, err := mg.DB.ExecContext(ctx, stmt, movieID)
+
+		mg.Cache.InvalidateMovie(movieID)
 
 		if err != nil {
+			span.RecordError(err)
 			return err
 		}
 
@@ -70,7 +89,8 @@ func (mg MoviesGenresModel) BulkUpdateMoviesFromGenre(movieID int, moviesGenres
 		SET movie_id = EXCLUDED.movie_id, genre_id = EXCLUDED.genre_id
 	)
 	DELETE FROM movies_genres
-	WHERE (movie_id, genre_id) NOT IN (SELECT movie_id, genre_id FROM synced);`, sClause)
+	WHERE movie_id = $%d
+	AND (movie_id, genre_id) NOT IN (SELECT movie_id, genre_id FROM synced);`, sClause, len(moviesGenres)*2+1)
 
 	val := []any{}
 
@@ -78,9 +98,14 @@ func (mg MoviesGenresModel) BulkUpdateMoviesFromGenre(movieID int, moviesGenres
 		val = append(val, v.MovieID, v.GenreID)
 	}
 
-	_, err := mg.DB.Exec(stmt, val...)
+	val = append(val, movieID)
+
+	_, err := mg.DB.ExecContext(ctx, stmt, val...)
+
+	mg.Cache.InvalidateMovie(movieID)
 
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
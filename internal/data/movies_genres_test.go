@@ -0,0 +1,140 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// The DELETE of a sync must only touch the rows of the movie being edited.
+func TestBulkUpdateMoviesFromGenreDeletesOnlyTheMoviesRows(t *testing.T) {
+	mg := MoviesGenresModel{DB: newRecordingDB(t, nil)}
+
+	err := mg.BulkUpdateMoviesFromGenre(context.Background(), 7, []MoviesGenres{{7, 1}, {7, 3}})
+
+	if err != nil {
+		t.Fatalf("BulkUpdateMoviesFromGenre() error = %v", err)
+	}
+
+	if len(recorder.execs) != 1 {
+		t.Fatalf("executed %d statements, want 1", len(recorder.execs))
+	}
+
+	exec := recorder.execs[0]
+
+	if !strings.Contains(exec.query, "WHERE movie_id = $5") {
+		t.Errorf("DELETE isn't scoped to the movie:\n%s", exec.query)
+	}
+
+	want := []any{int64(7), int64(1), int64(7), int64(3), int64(7)}
+
+	if !slices.Equal(exec.args, want) {
+		t.Errorf("args = %v, want %v", exec.args, want)
+	}
+}
+
+// TestBulkUpdateMoviesFromGenreLeavesOtherMoviesAlone runs against the migrated
+// PostgreSQL database in GREENLIGHT_TEST_DB_DSN, and is skipped without one.
+func TestBulkUpdateMoviesFromGenreLeavesOtherMoviesAlone(t *testing.T) {
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN isn't set")
+	}
+
+	sqlDB, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+
+	db := &DB{DB: sqlDB}
+
+	insertMovie := func(title string) int {
+		var id int
+
+		err := db.QueryRowContext(ctx, `INSERT INTO movies (title, year, runtime) VALUES ($1, 2016, 107) RETURNING id`, title).Scan(&id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { db.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, id) })
+
+		return id
+	}
+
+	insertGenre := func(title string) int {
+		var id int
+
+		err := db.QueryRowContext(ctx, `INSERT INTO genres (title) VALUES ($1) RETURNING id`, title).Scan(&id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { db.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, id) })
+
+		return id
+	}
+
+	genreIDs := func(movieID int) []int {
+		rows, err := db.QueryContext(ctx, `SELECT genre_id FROM movies_genres WHERE movie_id = $1 ORDER BY genre_id`, movieID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rows.Close()
+
+		ids := []int{}
+
+		for rows.Next() {
+			var id int
+
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+
+			ids = append(ids, id)
+		}
+
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		return ids
+	}
+
+	a, b := insertMovie("Movie A"), insertMovie("Movie B")
+	drama, comedy := insertGenre(t.Name()+" drama"), insertGenre(t.Name()+" comedy")
+
+	mg := MoviesGenresModel{DB: db}
+
+	for _, row := range []MoviesGenres{{a, drama}, {b, drama}, {b, comedy}} {
+		if err := mg.AddMovieToGenre(ctx, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mg.BulkUpdateMoviesFromGenre(ctx, a, []MoviesGenres{{a, comedy}}); err != nil {
+		t.Fatalf("BulkUpdateMoviesFromGenre() error = %v", err)
+	}
+
+	if got, want := genreIDs(a), []int{comedy}; !slices.Equal(got, want) {
+		t.Errorf("movie A genres = %v, want %v", got, want)
+	}
+
+	if got, want := genreIDs(b), []int{drama, comedy}; !slices.Equal(got, want) {
+		t.Errorf("movie B genres = %v, want %v", got, want)
+	}
+}
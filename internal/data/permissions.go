@@ -2,17 +2,33 @@ package data
 
 import (
 	"context"
-	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"kyawzayarwin.com/greenlight/internal/validator"
 )
 
 const (
-	PermissionMovieRead  = "movies:read"
-	PermissionMovieWrite = "movies:write"
+	PermissionMovieRead        = "movies:read"
+	PermissionMovieWrite       = "movies:write"
+	PermissionAdminDebug       = "admin:debug"
+	PermissionAdminAudit       = "admin:audit"
+	PermissionAdminPermissions = "admin:permissions"
 )
 
+// PermissionCodes are every permission a user can be granted.
+var PermissionCodes = []string{PermissionMovieRead, PermissionMovieWrite, PermissionAdminDebug, PermissionAdminAudit, PermissionAdminPermissions}
+
+func ValidatePermissionCodes(v *validator.Validator, codes []string) {
+	v.Check(len(codes) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(codes), "permissions", "must not contain duplicate values")
+
+	for _, code := range codes {
+		v.Check(validator.In(code, PermissionCodes...), "permissions", "must only contain "+strings.Join(PermissionCodes, ", "))
+	}
+}
+
 type Permissions []string
 
 func (p Permissions) Include(code string) bool {
@@ -26,10 +42,13 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (pm PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (pm PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	ctx, span := startSpan(ctx, "Permissions.GetAllForUser")
+	defer span.End()
+
 	stmt := `
 		SELECT permissions.code
 		FROM permissions
@@ -37,11 +56,18 @@ func (pm PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 		INNER JOIN users ON users_permissions.user_id = users.id
 		WHERE users.id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	rows, err := pm.DB.QueryContext(ctx, stmt, userID)
 
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
 	permissions := Permissions{}
 
 	for rows.Next() {
@@ -49,6 +75,7 @@ func (pm PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 		err := rows.Scan(&permission)
 
 		if err != nil {
+			span.RecordError(err)
 			return nil, err
 		}
 
@@ -56,21 +83,113 @@ func (pm PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	}
 
 	if rows.Err(); err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 
 	return permissions, nil
 }
 
-func (pm PermissionModel) AddForUser(userID int64, codes ...string) error {
-	stmt := `INSERT INTO users_permissions SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+// AddForUser grants the permissions to the user and records the grant in the audit
+// log, in the same transaction. Permissions the user already has are left alone.
+// The event says who granted them and from where; its action, outcome, subject and
+// details are set here.
+func (pm PermissionModel) AddForUser(ctx context.Context, userID int64, event AuditEvent, codes ...string) error {
+	ctx, span := startSpan(ctx, "Permissions.AddForUser")
+	defer span.End()
+
+	stmt := `
+		INSERT INTO users_permissions
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	tx, err := pm.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	defer tx.Rollback()
+
 	args := []any{userID, pq.Array(codes)}
 
-	_, err := pm.DB.ExecContext(ctx, stmt, args...)
+	_, err = tx.ExecContext(ctx, stmt, args...)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	event.Action = AuditPermissionGranted
+	event.Outcome = AuditSuccess
+	event.SubjectID = userID
+	event.Details = map[string]string{"permissions": strings.Join(codes, ",")}
+
+	err = insertAuditEvent(ctx, tx, &event)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	err = tx.Commit()
+
+	span.RecordError(err)
+
+	return err
+}
+
+// RemoveForUser revokes the permissions from the user and records the revocation
+// in the audit log, in the same transaction, like AddForUser.
+func (pm PermissionModel) RemoveForUser(ctx context.Context, userID int64, event AuditEvent, codes ...string) error {
+	ctx, span := startSpan(ctx, "Permissions.RemoveForUser")
+	defer span.End()
+
+	stmt := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := pm.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, stmt, userID, pq.Array(codes))
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	event.Action = AuditPermissionRevoked
+	event.Outcome = AuditSuccess
+	event.SubjectID = userID
+	event.Details = map[string]string{"permissions": strings.Join(codes, ",")}
+
+	err = insertAuditEvent(ctx, tx, &event)
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	err = tx.Commit()
+
+	span.RecordError(err)
 
 	return err
 }
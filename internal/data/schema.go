@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SchemaVersion is the version of the last migration in ./migrations, which the
+// models are written against. Bump it with every new migration.
+const SchemaVersion = 13
+
+// ErrSchemaDirty means that a migration failed half way and has to be fixed by hand.
+var ErrSchemaDirty = errors.New("schema is dirty")
+
+type SchemaModel struct {
+	DB *DB
+}
+
+// Version returns the version of the last migration applied to the database, as
+// recorded by migrate in the schema_migrations table. It's 0 when no migration has
+// been applied.
+func (m SchemaModel) Version(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "Schema.Version")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := m.DB.QueryRowContext(ctx, stmt).Scan(&version, &dirty)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, nil
+		default:
+			span.RecordError(err)
+			return 0, err
+		}
+	}
+
+	if dirty {
+		return version, ErrSchemaDirty
+	}
+
+	return version, nil
+}
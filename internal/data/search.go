@@ -0,0 +1,210 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"kyawzayarwin.com/greenlight/internal/validator"
+)
+
+// SortRelevance orders search results by how well they match the title query.
+const SortRelevance = "relevance"
+
+// SearchLanguageSafelist holds the PostgreSQL text search configurations a client
+// is allowed to pick with the lang query string parameter.
+var SearchLanguageSafelist = []string{
+	"simple",
+	"danish",
+	"dutch",
+	"english",
+	"finnish",
+	"french",
+	"german",
+	"hungarian",
+	"italian",
+	"norwegian",
+	"portuguese",
+	"romanian",
+	"russian",
+	"spanish",
+	"swedish",
+	"turkish",
+}
+
+// MovieQuery holds the search criteria for listing movies. Zero values mean the
+// criterion isn't applied.
+type MovieQuery struct {
+	Title    string
+	Language string
+
+	// Genres must all be present on a movie, at least one of GenresAny must be, and
+	// none of ExcludeGenres may be.
+	Genres        []string
+	GenresAny     []string
+	ExcludeGenres []string
+
+	YearMin    int
+	YearMax    int
+	RuntimeMin int
+	RuntimeMax int
+
+	// CreatedAfter is inclusive and CreatedBefore is exclusive, so consecutive
+	// ranges never overlap.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// IncludeGenres loads the genres of every movie. The genre joins and the
+	// aggregation are skipped entirely when it's false.
+	IncludeGenres bool
+}
+
+func ValidateMovieQuery(v *validator.Validator, q MovieQuery, f Filters) {
+	v.Check(validator.In(q.Language, SearchLanguageSafelist...), "lang", fmt.Sprintf("invalid language, must be one of %s", strings.Join(SearchLanguageSafelist, ",")))
+	v.Check(!validator.In(SortRelevance, f.sortValues()...) || q.Title != "", "sort", "relevance sorting requires a title search")
+
+	for _, genre := range q.ExcludeGenres {
+		v.Check(!validator.In(genre, q.Genres...), "genres", fmt.Sprintf("must not both include and exclude %q", genre))
+		v.Check(!validator.In(genre, q.GenresAny...), "genres_any", fmt.Sprintf("must not both include and exclude %q", genre))
+	}
+
+	v.Check(!slices.Contains(q.Genres, ""), "genres", "must not contain empty values")
+	v.Check(!slices.Contains(q.GenresAny, ""), "genres_any", "must not contain empty values")
+	v.Check(!slices.Contains(q.ExcludeGenres, ""), "genres", "must not contain empty values")
+
+	maxYear := time.Now().Year()
+
+	if q.YearMin != 0 {
+		v.Check(q.YearMin >= 1888, "year_min", "must be 1888 or later")
+		v.Check(q.YearMin <= maxYear, "year_min", "must not be in the future")
+	}
+
+	if q.YearMax != 0 {
+		v.Check(q.YearMax >= 1888, "year_max", "must be 1888 or later")
+		v.Check(q.YearMax >= q.YearMin, "year_max", "must not be less than year_min")
+	}
+
+	v.Check(q.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(q.RuntimeMax >= 0, "runtime_max", "must not be negative")
+
+	if q.RuntimeMax != 0 {
+		v.Check(q.RuntimeMax >= q.RuntimeMin, "runtime_max", "must not be less than runtime_min")
+	}
+
+	if !q.CreatedAfter.IsZero() && !q.CreatedBefore.IsZero() {
+		v.Check(q.CreatedBefore.After(q.CreatedAfter), "created_before", "must be later than created_after")
+	}
+}
+
+// escapedTitle is the movie title with the HTML special characters escaped, so
+// that the highlight is safe to use as HTML: only the <mark> tags are markup.
+const escapedTitle = `replace(replace(replace(replace(m.title, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;')`
+
+// searchClauses are the SQL fragments a MovieQuery contributes to a statement.
+type searchClauses struct {
+	where     string
+	rank      string
+	highlight string
+}
+
+// clauses builds the WHERE condition, rank and highlight expressions for q, adding
+// its values to args. The condition only references the movies table (aliased m),
+// so it can be reused by any statement that selects from it.
+func (q MovieQuery) clauses(args *sqlArgs) searchClauses {
+	// Without a title search every movie matches, ranks equally and has nothing to
+	// highlight.
+	c := searchClauses{where: "TRUE", rank: "0", highlight: "''"}
+
+	conditions := []string{}
+
+	if q.Title != "" {
+		title := args.add(q.Title)
+		language := args.add(q.Language) + "::regconfig"
+
+		// Fuzzy matching with trigrams lets "matrx" still find "The Matrix". Full-text
+		// matches also score on ts_rank(), so they come before the fuzzy fallbacks.
+		match := fmt.Sprintf("%s <%% m.title", title)
+		c.rank = fmt.Sprintf("word_similarity(%s, m.title)", title)
+
+		if tsquery := prefixTSQuery(q.Title); tsquery != "" {
+			vector := fmt.Sprintf("to_tsvector(%s, m.title)", language)
+			query := fmt.Sprintf("to_tsquery(%s, %s)", language, args.add(tsquery))
+
+			match = fmt.Sprintf("(%s @@ %s OR %s)", vector, query, match)
+			c.rank = fmt.Sprintf("ts_rank(%s, %s) + %s", vector, query, c.rank)
+			c.highlight = fmt.Sprintf("ts_headline(%s, %s, %s, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')", language, escapedTitle, query)
+		}
+
+		conditions = append(conditions, match)
+	}
+
+	if len(q.Genres) > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s <@ ARRAY(%s)", args.add(pq.Array(q.Genres)), movieGenreTitles))
+	}
+
+	if len(q.GenresAny) > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s && ARRAY(%s)", args.add(pq.Array(q.GenresAny)), movieGenreTitles))
+	}
+
+	if len(q.ExcludeGenres) > 0 {
+		conditions = append(conditions, fmt.Sprintf("NOT (%s && ARRAY(%s))", args.add(pq.Array(q.ExcludeGenres)), movieGenreTitles))
+	}
+
+	ranges := []struct {
+		column   string
+		operator string
+		value    any
+		isSet    bool
+	}{
+		{"m.year", ">=", q.YearMin, q.YearMin != 0},
+		{"m.year", "<=", q.YearMax, q.YearMax != 0},
+		{"m.runtime", ">=", q.RuntimeMin, q.RuntimeMin != 0},
+		{"m.runtime", "<=", q.RuntimeMax, q.RuntimeMax != 0},
+		{"m.created_at", ">=", q.CreatedAfter, !q.CreatedAfter.IsZero()},
+		{"m.created_at", "<", q.CreatedBefore, !q.CreatedBefore.IsZero()},
+	}
+
+	for _, r := range ranges {
+		if r.isSet {
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", r.column, r.operator, args.add(r.value)))
+		}
+	}
+
+	if len(conditions) > 0 {
+		c.where = strings.Join(conditions, " AND ")
+	}
+
+	return c
+}
+
+// movieGenreTitles selects the genre titles of the movie aliased m.
+const movieGenreTitles = `SELECT g.title FROM movies_genres AS mg
+			INNER JOIN genres AS g ON mg.genre_id = g.id
+			WHERE mg.movie_id = m.id`
+
+// prefixTSQuery turns free text like "the matr" into the tsquery "the:* & matr:*"
+// so that every word also matches as a prefix. Only letters and digits are kept,
+// which means the result is always safe to hand to to_tsquery().
+func prefixTSQuery(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i := range words {
+		words[i] = words[i] + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// sqlArgs collects the arguments of a dynamically built statement and hands back
+// the matching $n placeholder for each one.
+type sqlArgs []any
+
+func (a *sqlArgs) add(value any) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
@@ -86,10 +86,13 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (u *UserModel) Insert(user *User) error {
+func (u *UserModel) Insert(ctx context.Context, user *User) error {
+	ctx, span := startSpan(ctx, "Users.Insert")
+	defer span.End()
+
 	stmt := `
 		INSERT INTO users (name, email, password_hash, activated)
 		VALUES ($1, $2, $3, $4)	
@@ -97,7 +100,7 @@ func (u *UserModel) Insert(user *User) error {
 
 	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	row := u.DB.QueryRowContext(ctx, stmt, args...)
@@ -109,6 +112,7 @@ func (u *UserModel) Insert(user *User) error {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
 		default:
+			span.RecordError(err)
 			return err
 		}
 	}
@@ -116,14 +120,17 @@ func (u *UserModel) Insert(user *User) error {
 	return nil
 }
 
-func (u *UserModel) GetByEmail(email string) (*User, error) {
+func (u *UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, span := startSpan(ctx, "Users.GetByEmail")
+	defer span.End()
+
 	stmt := `
 		SELECT id, name, email, password_hash, activated, version
 		FROM users
 		WHERE email = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	var user User
@@ -137,6 +144,37 @@ func (u *UserModel) GetByEmail(email string) (*User, error) {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, err
 		default:
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (u *UserModel) Get(ctx context.Context, id int64) (*User, error) {
+	ctx, span := startSpan(ctx, "Users.Get")
+	defer span.End()
+
+	stmt := `
+		SELECT id, created_at, name, email, password_hash, activated, version
+		FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := u.DB.QueryRowContext(ctx, stmt, id).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			span.RecordError(err)
 			return nil, err
 		}
 	}
@@ -144,7 +182,10 @@ func (u *UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (u *UserModel) Update(user *User) error {
+func (u *UserModel) Update(ctx context.Context, user *User) error {
+	ctx, span := startSpan(ctx, "Users.Update")
+	defer span.End()
+
 	stmt := `
 		UPDATE users 
 		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
@@ -152,7 +193,7 @@ func (u *UserModel) Update(user *User) error {
 		RETURNING version
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	row := u.DB.QueryRowContext(ctx, stmt, user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version)
@@ -166,6 +207,7 @@ func (u *UserModel) Update(user *User) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
+			span.RecordError(err)
 			return err
 		}
 	}
@@ -173,7 +215,10 @@ func (u *UserModel) Update(user *User) error {
 	return nil
 }
 
-func (u *UserModel) GetFromToken(tokenScope string, tokenPlainText string) (*User, error) {
+func (u *UserModel) GetFromToken(ctx context.Context, tokenScope string, tokenPlainText string) (*User, error) {
+	ctx, span := startSpan(ctx, "Users.GetFromToken")
+	defer span.End()
+
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
 	stmt := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
@@ -188,7 +233,7 @@ func (u *UserModel) GetFromToken(tokenScope string, tokenPlainText string) (*Use
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := u.DB.QueryRowContext(ctx, stmt, args...).Scan(
@@ -206,6 +251,7 @@ func (u *UserModel) GetFromToken(tokenScope string, tokenPlainText string) (*Use
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
+			span.RecordError(err)
 			return nil, err
 		}
 
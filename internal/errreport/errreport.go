@@ -0,0 +1,412 @@
+// Package errreport reports panics and server errors to an error tracker, like
+// Sentry. Events are deduplicated by fingerprint and rate limited, so that an
+// incident doesn't flood the tracker, and sent in the background.
+package errreport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+// Frame is a function call on the stack.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+
+	// InApp is set for the application's own code, by Options.InAppPrefixes.
+	InApp bool
+}
+
+// Event is an error to report.
+type Event struct {
+	ID        string
+	Timestamp time.Time
+	Level     Level
+
+	// Type is the Go type of the error, like *pq.Error, and Message its text.
+	Type    string
+	Message string
+
+	// Stack lists the calls that led to the error, innermost first.
+	Stack []Frame
+
+	// Fingerprint groups events of the same error. Capture sets it when empty.
+	Fingerprint string
+
+	Request *Request
+	User    *User
+
+	Release     string
+	Environment string
+	ServerName  string
+
+	// Tags can be searched in the tracker, while Extra is only shown.
+	Tags  map[string]string
+	Extra map[string]any
+}
+
+type User struct {
+	ID        int64
+	IPAddress string
+}
+
+// NewEvent returns an event for err, with the stack of the caller of NewEvent. For
+// a *PanicError the stack is that of the panic instead.
+func NewEvent(err error) *Event {
+	event := &Event{
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+		Level:     LevelError,
+		Type:      fmt.Sprintf("%T", err),
+		Message:   err.Error(),
+		Tags:      map[string]string{},
+		Extra:     map[string]any{},
+	}
+
+	var panicErr *PanicError
+
+	switch {
+	case errors.As(err, &panicErr):
+		event.Level = LevelFatal
+		event.Type = fmt.Sprintf("panic(%T)", panicErr.Value)
+		event.Stack = panicErr.Stack
+	default:
+		event.Stack = CaptureStack(1)
+	}
+
+	return event
+}
+
+// PanicError is a recovered panic, with the stack it was raised on.
+type PanicError struct {
+	Value any
+	Stack []Frame
+}
+
+// NewPanicError wraps the value returned by recover. It must be called from the
+// deferred function that recovered, while the stack of the panic is still there.
+func NewPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: CaptureStack(1)}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value of the panic when it's an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// CaptureStack returns the stack of the caller, skipping skip more frames. Called
+// while a panic unwinds, it returns the stack from where the panic was raised.
+func CaptureStack(skip int) []Frame {
+	pc := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	var stack []Frame
+
+	for {
+		frame, more := frames.Next()
+
+		// The frames above the panic are those of the deferred function that
+		// recovered it.
+		if frame.Function == "runtime.gopanic" {
+			stack = stack[:0]
+		} else {
+			stack = append(stack, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return stack
+}
+
+var digits = regexp.MustCompile(`[0-9]+`)
+
+// fingerprint identifies the error regardless of the values in its message, like
+// IDs, so that every occurrence of it is grouped together.
+func (e *Event) fingerprint() string {
+	h := sha256.New()
+
+	fmt.Fprintln(h, e.Type)
+	fmt.Fprintln(h, digits.ReplaceAllString(e.Message, "0"))
+
+	// The application's frames are what tell errors apart, as errors from the
+	// same library call, like a failed query, are often raised by different code.
+	frames := 0
+
+	for _, frame := range e.Stack {
+		if frame.InApp && frames < 8 {
+			fmt.Fprintln(h, frame.Function)
+			frames++
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Transport sends events to a tracker. Send is called from a single goroutine, one
+// event at a time.
+type Transport interface {
+	Send(ctx context.Context, event *Event) error
+	Shutdown(ctx context.Context) error
+}
+
+// Options configures a Reporter.
+type Options struct {
+	// Release, Environment and ServerName are set on every event.
+	Release     string
+	Environment string
+	ServerName  string
+
+	// InAppPrefixes are the package path prefixes of the application's own code,
+	// like kyawzayarwin.com/greenlight/.
+	InAppPrefixes []string
+
+	// RateLimit is the most events sent per second on average, with bursts of up
+	// to Burst events. Events over the limit are dropped.
+	RateLimit float64
+	Burst     int
+
+	// DedupWindow is how long after an event others with the same fingerprint are
+	// dropped. The next one sent carries how many were.
+	DedupWindow time.Duration
+
+	// QueueSize is how many events can wait to be sent.
+	QueueSize int
+
+	// OnError is called with send errors, which are otherwise ignored.
+	OnError func(err error)
+}
+
+// Reporter sends events through a transport in the background.
+type Reporter struct {
+	transport Transport
+	opts      Options
+	limiter   *rate.Limiter
+
+	queue chan *Event
+	done  chan struct{}
+	stop  chan struct{}
+
+	mu      sync.Mutex
+	seen    map[string]*seen
+	dropped int64
+}
+
+type seen struct {
+	last       time.Time
+	duplicates int
+}
+
+// New returns a Reporter that sends through transport until Shutdown is called.
+func New(transport Transport, opts Options) *Reporter {
+	if opts.RateLimit <= 0 {
+		opts.RateLimit = 1
+	}
+
+	if opts.Burst <= 0 {
+		opts.Burst = 10
+	}
+
+	if opts.DedupWindow <= 0 {
+		opts.DedupWindow = time.Minute
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+
+	r := &Reporter{
+		transport: transport,
+		opts:      opts,
+		limiter:   rate.NewLimiter(rate.Limit(opts.RateLimit), opts.Burst),
+		queue:     make(chan *Event, opts.QueueSize),
+		done:      make(chan struct{}),
+		stop:      make(chan struct{}),
+		seen:      make(map[string]*seen),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Capture queues the event to be sent, unless an event with the same fingerprint
+// was sent within the dedup window, the rate limit is reached, or the queue is
+// full. It reports whether the event was queued.
+func (r *Reporter) Capture(event *Event) bool {
+	for i, frame := range event.Stack {
+		for _, prefix := range r.opts.InAppPrefixes {
+			if strings.HasPrefix(frame.Function, prefix) {
+				event.Stack[i].InApp = true
+			}
+		}
+	}
+
+	if event.Fingerprint == "" {
+		event.Fingerprint = event.fingerprint()
+	}
+
+	event.Release = r.opts.Release
+	event.Environment = r.opts.Environment
+	event.ServerName = r.opts.ServerName
+
+	if !r.dedup(event) {
+		return false
+	}
+
+	if !r.limiter.Allow() {
+		r.drop()
+		return false
+	}
+
+	select {
+	case <-r.stop:
+		r.drop()
+		return false
+	default:
+	}
+
+	select {
+	case r.queue <- event:
+		return true
+	default:
+		r.drop()
+		return false
+	}
+}
+
+// dedup reports whether the event is the first with its fingerprint in the dedup
+// window, and if so adds how many duplicates were dropped since the last one.
+func (r *Reporter) dedup(event *Event) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	s, ok := r.seen[event.Fingerprint]
+
+	if ok && now.Sub(s.last) < r.opts.DedupWindow {
+		s.duplicates++
+		return false
+	}
+
+	if ok && s.duplicates > 0 {
+		if event.Extra == nil {
+			event.Extra = map[string]any{}
+		}
+
+		event.Extra["duplicates_dropped"] = s.duplicates
+	}
+
+	// Forget the fingerprints that are out of the window now and then, so that
+	// the map doesn't grow for ever.
+	if len(r.seen) > 1000 {
+		for fingerprint, s := range r.seen {
+			if now.Sub(s.last) >= r.opts.DedupWindow {
+				delete(r.seen, fingerprint)
+			}
+		}
+	}
+
+	r.seen[event.Fingerprint] = &seen{last: now}
+
+	return true
+}
+
+func (r *Reporter) drop() {
+	r.mu.Lock()
+	r.dropped++
+	r.mu.Unlock()
+}
+
+// Dropped returns how many events were dropped for the rate limit or a full queue,
+// not counting duplicates.
+func (r *Reporter) Dropped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+
+	send := func(event *Event) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// An event that fails to send is dropped rather than retried, so that a
+		// tracker that's down doesn't hold events in memory.
+		err := r.transport.Send(ctx, event)
+
+		if err != nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+	}
+
+	for {
+		select {
+		case event := <-r.queue:
+			send(event)
+		case <-r.stop:
+			for {
+				select {
+				case event := <-r.queue:
+					send(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown sends the events that are queued and stops the reporter. Events
+// captured afterwards are dropped.
+func (r *Reporter) Shutdown(ctx context.Context) error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return r.transport.Shutdown(ctx)
+}
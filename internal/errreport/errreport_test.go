@@ -0,0 +1,177 @@
+package errreport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport keeps the events it's sent.
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (t *recordingTransport) Send(ctx context.Context, event *Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, event)
+
+	return nil
+}
+
+func (t *recordingTransport) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// sent stops the reporter, which sends what's queued, and returns what was sent.
+func (t *recordingTransport) sent(tb testing.TB, r *Reporter) []*Event {
+	tb.Helper()
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		tb.Fatalf("Shutdown() error = %v", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.events
+}
+
+func TestCaptureDeduplicates(t *testing.T) {
+	transport := &recordingTransport{}
+
+	r := New(transport, Options{RateLimit: 1000, Burst: 1000, DedupWindow: 50 * time.Millisecond})
+
+	// The same error, with different IDs in the message.
+	capture := func(id string) bool {
+		return r.Capture(NewEvent(errors.New("movie " + id + " not found")))
+	}
+
+	if !capture("1") {
+		t.Fatal("first event wasn't queued")
+	}
+
+	if capture("2") || capture("3") {
+		t.Fatal("duplicate was queued")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if !capture("4") {
+		t.Fatal("event after the dedup window wasn't queued")
+	}
+
+	events := transport.sent(t, r)
+
+	if len(events) != 2 {
+		t.Fatalf("sent %d events, want 2", len(events))
+	}
+
+	if _, ok := events[0].Extra["duplicates_dropped"]; ok {
+		t.Errorf("first event has duplicates_dropped = %v", events[0].Extra["duplicates_dropped"])
+	}
+
+	if got := events[1].Extra["duplicates_dropped"]; got != 2 {
+		t.Errorf("duplicates_dropped = %v, want 2", got)
+	}
+
+	// Duplicates aren't counted as dropped.
+	if got := r.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
+
+func TestCaptureRateLimits(t *testing.T) {
+	transport := &recordingTransport{}
+
+	r := New(transport, Options{RateLimit: 0.001, Burst: 2})
+
+	queued := 0
+
+	for _, msg := range []string{"alpha", "beta", "gamma", "delta", "epsilon"} {
+		if r.Capture(NewEvent(errors.New(msg))) {
+			queued++
+		}
+	}
+
+	if queued != 2 {
+		t.Errorf("queued %d events, want 2", queued)
+	}
+
+	if got := r.Dropped(); got != 3 {
+		t.Errorf("Dropped() = %d, want 3", got)
+	}
+
+	if events := transport.sent(t, r); len(events) != 2 {
+		t.Errorf("sent %d events, want 2", len(events))
+	}
+}
+
+func TestCaptureAfterShutdown(t *testing.T) {
+	transport := &recordingTransport{}
+
+	r := New(transport, Options{})
+
+	transport.sent(t, r)
+
+	if r.Capture(NewEvent(errors.New("late"))) {
+		t.Error("event captured after Shutdown was queued")
+	}
+
+	if got := r.Dropped(); got != 1 {
+		t.Errorf("Dropped() = %d, want 1", got)
+	}
+}
+
+func TestCaptureFingerprintsByAppFrames(t *testing.T) {
+	r := New(&recordingTransport{}, Options{InAppPrefixes: []string{"kyawzayarwin.com/greenlight/"}})
+	defer r.Shutdown(context.Background())
+
+	event := func(function string) *Event {
+		e := NewEvent(errors.New("query failed"))
+		e.Stack = []Frame{{Function: "database/sql.(*DB).QueryContext"}, {Function: function}}
+		r.Capture(e)
+		return e
+	}
+
+	a := event("kyawzayarwin.com/greenlight/internal/data.MovieModel.Get")
+	b := event("kyawzayarwin.com/greenlight/internal/data.UserModel.GetByEmail")
+
+	if !a.Stack[1].InApp || a.Stack[0].InApp {
+		t.Errorf("InApp = %v, %v, want false, true", a.Stack[0].InApp, a.Stack[1].InApp)
+	}
+
+	if a.Fingerprint == b.Fingerprint {
+		t.Error("errors raised by different application code have the same fingerprint")
+	}
+}
+
+func TestNewEventFromPanic(t *testing.T) {
+	var err error
+
+	func() {
+		defer func() {
+			err = NewPanicError(recover())
+		}()
+
+		panicky()
+	}()
+
+	event := NewEvent(err)
+
+	if event.Level != LevelFatal || event.Type != "panic(string)" || event.Message != "panic: boom" {
+		t.Errorf("event = %s %s %q", event.Level, event.Type, event.Message)
+	}
+
+	if len(event.Stack) == 0 || event.Stack[0].Function != "kyawzayarwin.com/greenlight/internal/errreport.panicky" {
+		t.Errorf("stack doesn't start where the panic was raised: %+v", event.Stack)
+	}
+}
+
+func panicky() {
+	panic("boom")
+}
@@ -0,0 +1,76 @@
+package errreport
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// filtered replaces the values that are left out of reports.
+const filtered = "[Filtered]"
+
+// sensitiveHeaders carry credentials. They're compared in canonical form.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Idempotency-Key":     true,
+	"X-Api-Key":           true,
+}
+
+// sensitiveParams are query string parameters whose names contain one of these.
+var sensitiveParams = []string{"token", "password", "secret", "key", "email"}
+
+// Request is what's reported of the request that failed. The body isn't kept, and
+// credentials in the headers and query string are filtered out.
+type Request struct {
+	Method      string
+	URL         string
+	QueryString string
+	Headers     map[string]string
+}
+
+// NewRequest returns the redacted request.
+func NewRequest(r *http.Request) *Request {
+	scheme := "http"
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	req := &Request{
+		Method:      r.Method,
+		URL:         scheme + "://" + r.Host + r.URL.Path,
+		QueryString: redactQuery(r.URL.Query()),
+		Headers:     make(map[string]string, len(r.Header)),
+	}
+
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			value = filtered
+		}
+
+		req.Headers[name] = value
+	}
+
+	return req
+}
+
+func redactQuery(query url.Values) string {
+	for name, values := range query {
+		lower := strings.ToLower(name)
+
+		for _, sensitive := range sensitiveParams {
+			if strings.Contains(lower, sensitive) {
+				for i := range values {
+					values[i] = filtered
+				}
+			}
+		}
+	}
+
+	return query.Encode()
+}
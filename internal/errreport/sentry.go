@@ -0,0 +1,206 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SentryTransport sends events to Sentry, or anything that speaks its protocol,
+// as envelopes over HTTP (https://develop.sentry.dev/sdk/data-model/envelopes/).
+type SentryTransport struct {
+	dsn      string
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+// NewSentryTransport returns a transport for the project of the DSN, which looks
+// like https://<public key>@<host>/<project ID>. A plain http DSN pointing at a
+// local stub works too.
+func NewSentryTransport(dsn string) (*SentryTransport, error) {
+	u, err := url.Parse(dsn)
+
+	if err != nil {
+		return nil, fmt.Errorf("errreport: invalid DSN: %w", err)
+	}
+
+	key := u.User.Username()
+
+	// The project ID is the last part of the path, after an optional prefix.
+	i := strings.LastIndex(u.Path, "/")
+	path, projectID := u.Path[:max(i, 0)], u.Path[i+1:]
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || key == "" || projectID == "" {
+		return nil, errors.New("errreport: DSN must look like https://<key>@<host>/<project ID>")
+	}
+
+	return &SentryTransport{
+		dsn:      dsn,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path, projectID),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=greenlight-errreport/1.0, sentry_key=%s", key),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (t *SentryTransport) Send(ctx context.Context, event *Event) error {
+	body, err := t.envelope(event)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", t.auth)
+
+	res, err := t.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("errreport: Sentry responded %s", res.Status)
+	}
+
+	return nil
+}
+
+func (t *SentryTransport) Shutdown(ctx context.Context) error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// envelope encodes the event as an envelope: a header line, then the header of the
+// event item and the event itself, each a line of JSON.
+func (t *SentryTransport) envelope(event *Event) ([]byte, error) {
+	payload, err := json.Marshal(sentryEvent(event))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+
+	err = enc.Encode(map[string]any{
+		"event_id": event.ID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":      t.dsn,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Encode(map[string]any{
+		"type":         "event",
+		"length":       len(payload),
+		"content_type": "application/json",
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf.Write(payload)
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// sentryEvent converts the event to Sentry's event payload
+// (https://develop.sentry.dev/sdk/data-model/event-payloads/).
+func sentryEvent(event *Event) map[string]any {
+	// Sentry lists frames oldest first.
+	frames := make([]map[string]any, 0, len(event.Stack))
+
+	for _, frame := range slices.Backward(event.Stack) {
+		module, function := splitFunction(frame.Function)
+
+		frames = append(frames, map[string]any{
+			"module":   module,
+			"function": function,
+			"abs_path": frame.File,
+			"lineno":   frame.Line,
+			"in_app":   frame.InApp,
+		})
+	}
+
+	payload := map[string]any{
+		"event_id":    event.ID,
+		"timestamp":   event.Timestamp.UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       string(event.Level),
+		"release":     event.Release,
+		"environment": event.Environment,
+		"server_name": event.ServerName,
+		"fingerprint": []string{event.Fingerprint},
+		"tags":        event.Tags,
+		"extra":       event.Extra,
+		"exception": map[string]any{
+			"values": []any{
+				map[string]any{
+					"type":       event.Type,
+					"value":      event.Message,
+					"stacktrace": map[string]any{"frames": frames},
+				},
+			},
+		},
+	}
+
+	if event.Request != nil {
+		payload["request"] = map[string]any{
+			"method":       event.Request.Method,
+			"url":          event.Request.URL,
+			"query_string": event.Request.QueryString,
+			"headers":      event.Request.Headers,
+		}
+	}
+
+	if event.User != nil {
+		user := map[string]any{"ip_address": event.User.IPAddress}
+
+		if event.User.ID != 0 {
+			user["id"] = fmt.Sprint(event.User.ID)
+		}
+
+		payload["user"] = user
+	}
+
+	return payload
+}
+
+// splitFunction splits a function name like
+// kyawzayarwin.com/greenlight/internal/data.MovieModel.Get into its package,
+// kyawzayarwin.com/greenlight/internal/data, and MovieModel.Get.
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+
+	dot := strings.Index(name[slash+1:], ".")
+
+	if dot < 0 {
+		return "", name
+	}
+
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
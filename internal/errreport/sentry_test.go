@@ -0,0 +1,248 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewSentryTransport(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		endpoint string
+	}{
+		{"https://abc123@o1.ingest.sentry.io/42", "https://o1.ingest.sentry.io/api/42/envelope/"},
+		{"http://abc123@localhost:9000/7", "http://localhost:9000/api/7/envelope/"},
+		{"https://abc123@sentry.example.com/prefix/42", "https://sentry.example.com/prefix/api/42/envelope/"},
+		{"https://abc123@sentry.example.com/a/b/42", "https://sentry.example.com/a/b/api/42/envelope/"},
+	}
+
+	for _, tt := range tests {
+		transport, err := NewSentryTransport(tt.dsn)
+
+		if err != nil {
+			t.Errorf("NewSentryTransport(%q) error = %v", tt.dsn, err)
+			continue
+		}
+
+		if transport.endpoint != tt.endpoint {
+			t.Errorf("NewSentryTransport(%q) endpoint = %q, want %q", tt.dsn, transport.endpoint, tt.endpoint)
+		}
+
+		if !strings.Contains(transport.auth, "sentry_key=abc123") {
+			t.Errorf("NewSentryTransport(%q) auth = %q, want the key in it", tt.dsn, transport.auth)
+		}
+	}
+
+	for _, dsn := range []string{
+		"",
+		"://",
+		"https://o1.ingest.sentry.io/42",
+		"https://abc123@o1.ingest.sentry.io/",
+		"https://abc123@o1.ingest.sentry.io",
+		"ftp://abc123@o1.ingest.sentry.io/42",
+		"https://abc123@/42",
+	} {
+		if _, err := NewSentryTransport(dsn); err == nil {
+			t.Errorf("NewSentryTransport(%q) error = nil, want an error", dsn)
+		}
+	}
+}
+
+// sentryStub is a Sentry server that records the requests it gets.
+type sentryStub struct {
+	*httptest.Server
+	status   int
+	requests chan *stubRequest
+}
+
+type stubRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newSentryStub(t *testing.T, status int) *sentryStub {
+	t.Helper()
+
+	stub := &sentryStub{status: status, requests: make(chan *stubRequest, 10)}
+
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		stub.requests <- &stubRequest{path: r.URL.Path, header: r.Header, body: body}
+
+		w.WriteHeader(stub.status)
+	}))
+
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (s *sentryStub) dsn() string {
+	return strings.Replace(s.URL, "http://", "http://abc123@", 1) + "/42"
+}
+
+func TestSentryTransportSendsEnvelope(t *testing.T) {
+	stub := newSentryStub(t, http.StatusOK)
+
+	transport, err := NewSentryTransport(stub.dsn())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := NewEvent(errors.New("pq: relation \"movies\" does not exist"))
+	event.Fingerprint = "f00"
+	event.Stack = []Frame{
+		{Function: "kyawzayarwin.com/greenlight/internal/data.MovieModel.Get", File: "movies.go", Line: 90, InApp: true},
+		{Function: "net/http.HandlerFunc.ServeHTTP", File: "server.go", Line: 2220},
+	}
+	event.User = &User{ID: 7, IPAddress: "203.0.113.7"}
+	event.Tags["route"] = "GET /v1/movies/{id}"
+
+	if err := transport.Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	req := <-stub.requests
+
+	if req.path != "/api/42/envelope/" {
+		t.Errorf("path = %q, want /api/42/envelope/", req.path)
+	}
+
+	if got := req.header.Get("Content-Type"); got != "application/x-sentry-envelope" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	if got := req.header.Get("X-Sentry-Auth"); !strings.Contains(got, "sentry_key=abc123") {
+		t.Errorf("X-Sentry-Auth = %q", got)
+	}
+
+	// The envelope is a header, an item header and the item, each on a line.
+	lines := bytes.Split(bytes.TrimSuffix(req.body, []byte("\n")), []byte("\n"))
+
+	if len(lines) != 3 {
+		t.Fatalf("envelope has %d lines, want 3:\n%s", len(lines), req.body)
+	}
+
+	var header struct {
+		EventID string `json:"event_id"`
+		SentAt  string `json:"sent_at"`
+		DSN     string `json:"dsn"`
+	}
+
+	if err := json.Unmarshal(lines[0], &header); err != nil {
+		t.Fatalf("envelope header: %v", err)
+	}
+
+	if header.EventID != event.ID || header.DSN != stub.dsn() || header.SentAt == "" {
+		t.Errorf("envelope header = %+v", header)
+	}
+
+	var item struct {
+		Type        string `json:"type"`
+		Length      int    `json:"length"`
+		ContentType string `json:"content_type"`
+	}
+
+	if err := json.Unmarshal(lines[1], &item); err != nil {
+		t.Fatalf("item header: %v", err)
+	}
+
+	if item.Type != "event" || item.ContentType != "application/json" {
+		t.Errorf("item header = %+v", item)
+	}
+
+	if item.Length != len(lines[2]) {
+		t.Errorf("item length = %d, want %d", item.Length, len(lines[2]))
+	}
+
+	var payload struct {
+		EventID     string            `json:"event_id"`
+		Level       string            `json:"level"`
+		Fingerprint []string          `json:"fingerprint"`
+		Tags        map[string]string `json:"tags"`
+		User        map[string]string `json:"user"`
+		Exception   struct {
+			Values []struct {
+				Type       string `json:"type"`
+				Value      string `json:"value"`
+				Stacktrace struct {
+					Frames []struct {
+						Module   string `json:"module"`
+						Function string `json:"function"`
+						InApp    bool   `json:"in_app"`
+					} `json:"frames"`
+				} `json:"stacktrace"`
+			} `json:"values"`
+		} `json:"exception"`
+	}
+
+	if err := json.Unmarshal(lines[2], &payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+
+	if payload.EventID != event.ID || payload.Level != "error" || payload.Fingerprint[0] != "f00" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	if payload.Tags["route"] != "GET /v1/movies/{id}" || payload.User["id"] != "7" || payload.User["ip_address"] != "203.0.113.7" {
+		t.Errorf("payload tags = %v, user = %v", payload.Tags, payload.User)
+	}
+
+	exception := payload.Exception.Values[0]
+
+	if exception.Type != "*errors.errorString" || exception.Value != event.Message {
+		t.Errorf("exception = %+v", exception)
+	}
+
+	// Sentry lists frames oldest first.
+	frames := exception.Stacktrace.Frames
+
+	if len(frames) != 2 || frames[1].Module != "kyawzayarwin.com/greenlight/internal/data" || frames[1].Function != "MovieModel.Get" || !frames[1].InApp || frames[0].InApp {
+		t.Errorf("frames = %+v", frames)
+	}
+}
+
+func TestSentryTransportReportsErrorStatus(t *testing.T) {
+	stub := newSentryStub(t, http.StatusTooManyRequests)
+
+	transport, err := NewSentryTransport(stub.dsn())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := transport.Send(context.Background(), NewEvent(errors.New("boom"))); err == nil {
+		t.Error("Send() error = nil, want an error")
+	}
+}
+
+func TestSplitFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   string
+		function string
+	}{
+		{"kyawzayarwin.com/greenlight/internal/data.MovieModel.Get", "kyawzayarwin.com/greenlight/internal/data", "MovieModel.Get"},
+		{"main.(*application).recoverPanic.func1", "main", "(*application).recoverPanic.func1"},
+		{"net/http.HandlerFunc.ServeHTTP", "net/http", "HandlerFunc.ServeHTTP"},
+		{"nodot", "", "nodot"},
+	}
+
+	for _, tt := range tests {
+		module, function := splitFunction(tt.name)
+
+		if module != tt.module || function != tt.function {
+			t.Errorf("splitFunction(%q) = %q, %q, want %q, %q", tt.name, module, function, tt.module, tt.function)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package health runs the dependency checks behind a readiness probe, in parallel
+// and each with its own timeout.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+)
+
+// Check is a dependency the application needs to serve requests, like the
+// database. Fn returns nil when the dependency is usable.
+type Check struct {
+	Name string
+	Fn   func(ctx context.Context) error
+
+	// Timeout bounds Fn. Zero uses the timeout given to Run.
+	Timeout time.Duration
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status    Status  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report holds the results of all the checks, by name.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Run runs the checks at the same time and waits for all of them. A check fails
+// when Fn returns an error, panics, or is still running at its timeout; Run doesn't
+// wait for the checks that time out to return. The report passes when every check
+// does.
+func Run(ctx context.Context, timeout time.Duration, checks ...Check) Report {
+	report := Report{
+		Status: StatusPass,
+		Checks: make(map[string]Result, len(checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, check := range checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			result := run(ctx, check, timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[check.Name] = result
+
+			if result.Status != StatusPass {
+				report.Status = StatusFail
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, check Check, timeout time.Duration) Result {
+	if check.Timeout > 0 {
+		timeout = check.Timeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// The check runs on a goroutine of its own so that one ignoring its context
+	// can't hold up the report.
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				done <- fmt.Errorf("panic: %v", err)
+			}
+		}()
+
+		done <- check.Fn(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+
+	result := Result{
+		Status:    StatusPass,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -1,18 +1,24 @@
 package jsonlog
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
-	"runtime/debug"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,64 +26,173 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
-		return "FETAL"
+		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel parses a level name, like "debug" or "WARN".
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// MarshalText and UnmarshalText let levels be used with flag.TextVar.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(l.String())), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*l = level
+
+	return nil
+}
+
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	out io.Writer
+	mu  sync.Mutex
+
+	// The levels can be changed while the logger is in use.
+	minLevel   atomic.Int32
+	stackLevel atomic.Int32
+
+	sampler atomic.Pointer[sampler]
 }
 
+// New returns a logger that writes entries at minLevel and above to out. Entries
+// at LevelError and above carry a stack trace.
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out:      out,
-		minLevel: minLevel,
-	}
+	l := &Logger{out: out}
+
+	l.SetLevel(minLevel)
+	l.SetStackLevel(LevelError)
+
+	return l
+}
+
+// SetLevel changes the minimum level of the entries that are written.
+func (l *Logger) SetLevel(level Level) {
+	l.minLevel.Store(int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
+}
+
+// SetStackLevel changes the level from which entries carry a stack trace. With
+// LevelOff no entry does.
+func (l *Logger) SetStackLevel(level Level) {
+	l.stackLevel.Store(int32(level))
+}
+
+// Enabled reports whether entries at the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) PrintDebug(message string, properties map[string]any) {
+	l.print(LevelDebug, message, properties)
 }
 
-func (l *Logger) PrintInfo(message string, properties map[string]string) {
+func (l *Logger) PrintInfo(message string, properties map[string]any) {
 	l.print(LevelInfo, message, properties)
 }
-func (l *Logger) PrintError(err error, properties map[string]string) {
+
+func (l *Logger) PrintWarn(message string, properties map[string]any) {
+	l.print(LevelWarn, message, properties)
+}
+
+func (l *Logger) PrintError(err error, properties map[string]any) {
 	l.print(LevelError, err.Error(), properties)
 }
-func (l *Logger) PrintFatal(err error, properties map[string]string) {
+
+func (l *Logger) PrintFatal(err error, properties map[string]any) {
 	l.print(LevelFatal, err.Error(), properties)
 	os.Exit(1) // For entries at the FATAL level, we also terminate the application.
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
+// PrintInfoContext is PrintInfo with the properties stored in ctx added, like the
+// request ID of the request being handled.
+func (l *Logger) PrintInfoContext(ctx context.Context, message string, properties map[string]any) {
+	l.print(LevelInfo, message, withContextProperties(ctx, properties))
+}
+
+func (l *Logger) PrintDebugContext(ctx context.Context, message string, properties map[string]any) {
+	l.print(LevelDebug, message, withContextProperties(ctx, properties))
+}
+
+func (l *Logger) PrintWarnContext(ctx context.Context, message string, properties map[string]any) {
+	l.print(LevelWarn, message, withContextProperties(ctx, properties))
+}
+
+func (l *Logger) PrintErrorContext(ctx context.Context, err error, properties map[string]any) {
+	l.print(LevelError, err.Error(), withContextProperties(ctx, properties))
+}
+
+func (l *Logger) PrintFatalContext(ctx context.Context, err error, properties map[string]any) {
+	l.print(LevelFatal, err.Error(), withContextProperties(ctx, properties))
+	os.Exit(1)
+}
+
+func (l *Logger) print(level Level, message string, properties map[string]any) (int, error) {
 	// If the severity level of the log entry is below the minimum severity for the
 	// logger, then return with no further action.
-	if level < l.minLevel {
+	if !l.Enabled(level) {
 		return 0, nil
 	}
 
+	// Fatal entries are never sampled away, as they're the last word.
+	if s := l.sampler.Load(); s != nil && level < LevelFatal {
+		ok, dropped := s.allow(level, message)
+
+		if !ok {
+			return 0, nil
+		}
+
+		if dropped > 0 {
+			properties = withProperty(properties, "sampled_dropped", dropped)
+		}
+	}
+
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties"`
-		Trace      string            `json:"trace"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
-		Properties: properties,
+		Properties: normalize(properties),
 	}
 
-	// Include a stack trace for entries at the ERROR and FATAL levels.
-	if level >= LevelError {
-		aux.Trace = string(debug.Stack())
+	// Include a stack trace for entries at or above the stack level.
+	if level >= Level(l.stackLevel.Load()) {
+		aux.Trace = stack()
 	}
 
 	line, err := json.Marshal(aux)
@@ -96,3 +211,147 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 func (l *Logger) Write(message []byte) (n int, err error) {
 	return l.print(LevelError, string(message), nil)
 }
+
+// normalize turns values that JSON encodes unhelpfully into strings, like errors,
+// which would become {}, and durations, which would be nanoseconds.
+func normalize(properties map[string]any) map[string]any {
+	var out map[string]any
+
+	for key, value := range properties {
+		var s string
+
+		switch v := value.(type) {
+		case error:
+			s = v.Error()
+		case time.Duration:
+			s = v.String()
+		default:
+			continue
+		}
+
+		if out == nil {
+			out = make(map[string]any, len(properties))
+
+			for key, value := range properties {
+				out[key] = value
+			}
+		}
+
+		out[key] = s
+	}
+
+	if out == nil {
+		return properties
+	}
+
+	return out
+}
+
+func withProperty(properties map[string]any, key string, value any) map[string]any {
+	out := make(map[string]any, len(properties)+1)
+
+	for k, v := range properties {
+		out[k] = v
+	}
+
+	out[key] = value
+
+	return out
+}
+
+// stack formats the goroutine's stack from the caller of the logger on, one
+// "function\n\tfile:line" per frame like a panic. The frames of the logger itself,
+// and of log/slog when logging through the Handler, are left out.
+func stack() string {
+	pc := make([]uintptr, 64)
+	n := runtime.Callers(1, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	var b strings.Builder
+
+	for {
+		frame, more := frames.Next()
+
+		if !strings.HasPrefix(frame.Function, "kyawzayarwin.com/greenlight/internal/jsonlog.") && !strings.HasPrefix(frame.Function, "log/slog.") {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+type contextKey struct{}
+
+// contextProperties are shared by every copy of the context they were stored in,
+// so a property set deep in a request, like the user once they're authenticated,
+// is logged by code further out too.
+type contextProperties struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+// NewContext returns a copy of ctx that SetProperty can store properties in. The
+// properties already in ctx, if any, are copied over.
+func NewContext(ctx context.Context) context.Context {
+	props := &contextProperties{values: ContextProperties(ctx)}
+
+	if props.values == nil {
+		props.values = make(map[string]any)
+	}
+
+	return context.WithValue(ctx, contextKey{}, props)
+}
+
+// SetProperty stores a property in ctx, which every entry logged with the context
+// will carry. It does nothing when ctx doesn't come from NewContext.
+func SetProperty(ctx context.Context, key string, value any) {
+	props, ok := ctx.Value(contextKey{}).(*contextProperties)
+
+	if !ok {
+		return
+	}
+
+	props.mu.Lock()
+	props.values[key] = value
+	props.mu.Unlock()
+}
+
+// ContextProperties returns a copy of the properties stored in ctx, or nil.
+func ContextProperties(ctx context.Context) map[string]any {
+	props, ok := ctx.Value(contextKey{}).(*contextProperties)
+
+	if !ok {
+		return nil
+	}
+
+	props.mu.Lock()
+	defer props.mu.Unlock()
+
+	values := make(map[string]any, len(props.values))
+
+	for key, value := range props.values {
+		values[key] = value
+	}
+
+	return values
+}
+
+// withContextProperties merges the properties of ctx with the given ones, which
+// win when both have a key.
+func withContextProperties(ctx context.Context, properties map[string]any) map[string]any {
+	merged := ContextProperties(ctx)
+
+	if merged == nil {
+		return properties
+	}
+
+	for key, value := range properties {
+		merged[key] = value
+	}
+
+	return merged
+}
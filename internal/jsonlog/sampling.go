@@ -0,0 +1,94 @@
+package jsonlog
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampling limits how often the same message is logged. In every Tick, the first
+// Initial entries with a given level and message are written, and after that only
+// every Thereafter-th one. The next entry written after some were dropped carries
+// the number dropped as the sampled_dropped property.
+type Sampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// SetSampling turns sampling on, or off with a zero Sampling. Fatal entries are
+// never sampled.
+func (l *Logger) SetSampling(s Sampling) {
+	if s.Initial <= 0 && s.Thereafter <= 0 {
+		l.sampler.Store(nil)
+		return
+	}
+
+	if s.Tick <= 0 {
+		s.Tick = time.Second
+	}
+
+	l.sampler.Store(&sampler{config: s, counts: make(map[samplerKey]*sampleCount)})
+}
+
+type samplerKey struct {
+	level   Level
+	message string
+}
+
+type sampleCount struct {
+	reset   time.Time
+	n       int
+	dropped int
+}
+
+type sampler struct {
+	config Sampling
+
+	mu     sync.Mutex
+	counts map[samplerKey]*sampleCount
+}
+
+// allow reports whether to write the entry and, if so, how many entries like it
+// were dropped since the last one written.
+func (s *sampler) allow(level Level, message string) (bool, int) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := samplerKey{level, message}
+	count, ok := s.counts[key]
+
+	if !ok || now.After(count.reset) {
+		// Forget the messages of past ticks, so that the map doesn't grow with
+		// every distinct message ever logged.
+		if !ok && len(s.counts) >= 10000 {
+			for k, c := range s.counts {
+				if now.After(c.reset) {
+					delete(s.counts, k)
+				}
+			}
+		}
+
+		dropped := 0
+
+		if ok {
+			dropped = count.dropped
+		}
+
+		count = &sampleCount{reset: now.Add(s.config.Tick), dropped: dropped}
+		s.counts[key] = count
+	}
+
+	count.n++
+
+	if count.n <= s.config.Initial || (s.config.Thereafter > 0 && (count.n-s.config.Initial)%s.config.Thereafter == 0) {
+		dropped := count.dropped
+		count.dropped = 0
+		return true, dropped
+	}
+
+	count.dropped++
+
+	return false, 0
+}
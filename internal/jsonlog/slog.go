@@ -0,0 +1,115 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Handler lets code that logs with log/slog write through a Logger. Attributes
+// become properties, with the names of groups as prefixes, like "http.status".
+type Handler struct {
+	logger *Logger
+	attrs  []slog.Attr
+	group  string
+}
+
+// NewHandler returns a slog.Handler that writes to l. slog levels map to the
+// nearest level at or below them, so slog.LevelWarn+2 is a warning.
+func NewHandler(l *Logger) *Handler {
+	return &Handler{logger: l}
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	properties := ContextProperties(ctx)
+
+	if properties == nil {
+		properties = make(map[string]any, len(h.attrs)+record.NumAttrs())
+	}
+
+	for _, attr := range h.attrs {
+		addAttr(properties, "", attr)
+	}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(properties, h.group, attr)
+		return true
+	})
+
+	_, err := h.logger.print(fromSlogLevel(record.Level), record.Message, properties)
+
+	return err
+}
+
+// addAttr adds attr to properties under its name, prefixed with the group it's
+// in. Groups are flattened, and empty attributes are skipped, like slog does.
+func addAttr(properties map[string]any, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	key := attr.Key
+
+	if group != "" && key != "" {
+		key = group + "." + key
+	} else if group != "" {
+		key = group
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, a := range attr.Value.Group() {
+			addAttr(properties, key, a)
+		}
+		return
+	}
+
+	properties[key] = attr.Value.Any()
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+
+	// Attributes added within a group are stored with the group as their own
+	// group, so that they keep it when more groups are opened later.
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr = slog.Attr{Key: h.group, Value: slog.GroupValue(attr)}
+		}
+
+		h2.attrs = append(h2.attrs, attr)
+	}
+
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.group = strings.TrimPrefix(h.group+"."+name, ".")
+
+	return &h2
+}
@@ -2,12 +2,16 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"net"
+	"strconv"
 	"time"
 
 	"html/template"
 
 	"github.com/go-mail/mail/v2"
+	"kyawzayarwin.com/greenlight/internal/tracing"
 )
 
 //go:embed "templates"
@@ -28,9 +32,29 @@ func New(host string, port int, username, password, sender string) Mailer {
 	}
 }
 
-func (m Mailer) Send(recipient, templateFile string, data any) error {
+// Ping checks that the SMTP server accepts connections, without logging in or
+// sending anything.
+func (m Mailer) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.dialer.Host, strconv.Itoa(m.dialer.Port)))
+
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func (m Mailer) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	_, span := tracing.Start(ctx, "Mailer.Send")
+	defer span.End()
+
+	span.SetAttribute("mail.template", templateFile)
+
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
@@ -68,12 +92,17 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 
 	// Retry up to 3 times
 	for i := 1; i <= 3; i++ {
+		span.SetAttribute("mail.attempts", i)
+
 		err := m.dialer.DialAndSend(msg)
 
 		if nil == err {
+			span.SetStatus(tracing.StatusOK, "")
 			return nil
 		}
 
+		span.RecordError(err)
+
 		time.Sleep(500 * time.Millisecond)
 	}
 
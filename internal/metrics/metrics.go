@@ -0,0 +1,400 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the
+// Prometheus text exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suited to the latency
+// of HTTP requests.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them out when scraped.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]collector
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]collector)}
+}
+
+func (reg *Registry) register(name string, c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, exists := reg.metrics[name]; exists {
+		panic(fmt.Sprintf("metrics: %s is already registered", name))
+	}
+
+	reg.metrics[name] = c
+}
+
+// WriteTo writes every metric, sorted by name.
+func (reg *Registry) WriteTo(out io.Writer) (int64, error) {
+	reg.mu.Lock()
+	names := make([]string, 0, len(reg.metrics))
+
+	for name := range reg.metrics {
+		names = append(names, name)
+	}
+
+	collectors := make([]collector, len(names))
+	slices.Sort(names)
+
+	for i, name := range names {
+		collectors[i] = reg.metrics[name]
+	}
+	reg.mu.Unlock()
+
+	cw := &countingWriter{w: out}
+	w := bufio.NewWriter(cw)
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+
+	err := w.Flush()
+
+	return cw.n, err
+}
+
+// Handler serves the metrics to a Prometheus scraper.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// desc is what every metric has: a name, help text and label names.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// labelPairs formats label names and values as {a="1",b="2"}, with extra pairs like
+// le="0.5" appended. It returns an empty string when there are no labels.
+func labelPairs(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+
+	for i := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, names[i], escapeLabel(values[i])))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel escapes backslashes, double quotes and newlines in a label value, the
+// only escapes the exposition format has.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(strings.ToValidUTF8(s, "\uFFFD"))
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// vec holds one series per combination of label values.
+type vec[T any] struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*T
+	keys   map[string][]string
+	newT   func() *T
+}
+
+func newVec[T any](d desc, newT func() *T) *vec[T] {
+	v := &vec[T]{desc: d, series: make(map[string]*T), keys: make(map[string][]string), newT: newT}
+
+	// A metric without labels has a single series, which is reported from the
+	// start, even before anything is counted.
+	if len(d.labels) == 0 {
+		v.get(nil)
+	}
+
+	return v
+}
+
+func (v *vec[T]) get(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+
+	if !ok {
+		s = v.newT()
+		v.series[key] = s
+		v.keys[key] = slices.Clone(values)
+	}
+
+	return s
+}
+
+// each calls fn for every series, sorted by label values.
+func (v *vec[T]) each(fn func(values []string, s *T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	series := make([]*T, len(keys))
+	values := make([][]string, len(keys))
+
+	for i, key := range keys {
+		series[i] = v.series[key]
+		values[i] = v.keys[key]
+	}
+	v.mu.Unlock()
+
+	for i := range series {
+		fn(values[i], series[i])
+	}
+}
+
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (val *value) add(delta float64) {
+	val.mu.Lock()
+	val.v += delta
+	val.mu.Unlock()
+}
+
+func (val *value) set(v float64) {
+	val.mu.Lock()
+	val.v = v
+	val.mu.Unlock()
+}
+
+func (val *value) get() float64 {
+	val.mu.Lock()
+	defer val.mu.Unlock()
+	return val.v
+}
+
+// Counter is a value that only goes up, like a number of requests.
+type Counter struct {
+	*vec[value]
+}
+
+// NewCounter registers a counter with the given label names.
+func (reg *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(desc{name, help, "counter", labels}, func() *value { return &value{} })}
+	reg.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds delta, which must not be negative, to the series.
+func (c *Counter) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.name))
+	}
+
+	c.get(labels).add(delta)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.each(func(values []string, s *value) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, values), formatFloat(s.get()))
+	})
+}
+
+// Gauge is a value that goes up and down, like the number of requests in flight.
+type Gauge struct {
+	*vec[value]
+}
+
+// NewGauge registers a gauge with the given label names.
+func (reg *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(desc{name, help, "gauge", labels}, func() *value { return &value{} })}
+	reg.register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.get(labels).set(v)
+}
+
+func (g *Gauge) Add(delta float64, labels ...string) {
+	g.get(labels).add(delta)
+}
+
+func (g *Gauge) Inc(labels ...string) {
+	g.Add(1, labels...)
+}
+
+func (g *Gauge) Dec(labels ...string) {
+	g.Add(-1, labels...)
+}
+
+// Value returns the current value of the series with the given label values.
+func (g *Gauge) Value(labels ...string) float64 {
+	return g.get(labels).get()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.each(func(values []string, s *value) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelPairs(g.labels, values), formatFloat(s.get()))
+	})
+}
+
+// funcMetric is a metric without labels whose value is read when scraped.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge that calls fn for its value on every scrape.
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	reg.register(name, &funcMetric{desc{name: name, help: help, kind: "gauge"}, fn})
+}
+
+// NewCounterFunc registers a counter that calls fn for its value on every scrape,
+// for totals that something else keeps, like the wait count of a sql.DB.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	reg.register(name, &funcMetric{desc{name: name, help: help, kind: "counter"}, fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+type histogramSeries struct {
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations, like request durations, in buckets.
+type Histogram struct {
+	*vec[histogramSeries]
+	buckets []float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds, which
+// must be sorted, and label names.
+func (reg *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s must be sorted", name))
+	}
+
+	h := &Histogram{
+		vec: newVec(desc{name, help, "histogram", labels}, func() *histogramSeries {
+			return &histogramSeries{counts: make([]uint64, len(buckets))}
+		}),
+		buckets: slices.Clone(buckets),
+	}
+
+	reg.register(name, h)
+
+	return h
+}
+
+// Observe adds v to the series with the given label values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	s := h.get(labels)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.each(func(values []string, s *histogramSeries) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Buckets are cumulative in the exposition format.
+		var cumulative uint64
+
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, values, "le", formatFloat(bound)), cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, values), s.count)
+	})
+}
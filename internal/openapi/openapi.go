@@ -0,0 +1,235 @@
+// Package openapi holds the OpenAPI 3.1 documents of the API, one per version, and
+// validates requests against them.
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"kyawzayarwin.com/greenlight/internal/patch"
+)
+
+// The v1 document is complete. Every later version is a JSON Merge Patch over it,
+// named after the version, holding only what changed.
+//
+//go:embed "openapi.json" "v2.json" "docs.html"
+var files embed.FS
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Document is the OpenAPI document of one API version.
+type Document struct {
+	raw  []byte
+	root map[string]any
+}
+
+// Load returns the document of the given API version, like "v1".
+func Load(version string) (*Document, error) {
+	raw, err := files.ReadFile("openapi.json")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if version != "v1" {
+		overlay, err := files.ReadFile(version + ".json")
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("openapi: no document for version %q", version)
+			}
+			return nil, err
+		}
+
+		raw, err = patch.Merge(raw, overlay)
+
+		if err != nil {
+			return nil, fmt.Errorf("openapi: applying %s.json: %w", version, err)
+		}
+	}
+
+	doc := &Document{raw: raw}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	if err := dec.Decode(&doc.root); err != nil {
+		return nil, fmt.Errorf("openapi: decoding the %s document: %w", version, err)
+	}
+
+	return doc, nil
+}
+
+// MustLoad is like Load but panics on error. The documents are embedded, so an
+// error is a bug in them.
+func MustLoad(version string) *Document {
+	doc, err := Load(version)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return doc
+}
+
+// JSON returns the document as served to clients.
+func (d *Document) JSON() []byte {
+	return d.raw
+}
+
+// DocsPage returns the HTML page that renders the document next to it.
+func DocsPage() []byte {
+	page, _ := files.ReadFile("docs.html")
+	return page
+}
+
+// Route is an endpoint, with an upper case method and a path relative to the
+// server URL, like GET /movies/{id}.
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (rt Route) String() string {
+	return rt.Method + " " + rt.Path
+}
+
+// Routes returns every operation in the document, sorted by path and method.
+func (d *Document) Routes() []Route {
+	paths, _ := d.root["paths"].(map[string]any)
+
+	routes := []Route{}
+
+	for path, item := range paths {
+		item, _ := item.(map[string]any)
+
+		for _, method := range methods {
+			if _, ok := item[method]; ok {
+				routes = append(routes, Route{Method: strings.ToUpper(method), Path: path})
+			}
+		}
+	}
+
+	slices.SortFunc(routes, func(a, b Route) int {
+		return strings.Compare(a.Path+" "+a.Method, b.Path+" "+b.Method)
+	})
+
+	return routes
+}
+
+// Diff compares the routes a server serves with the document. It returns the
+// served routes the document is missing, and the documented routes that aren't
+// served.
+func (d *Document) Diff(served []Route) (undocumented, unserved []Route) {
+	documented := d.Routes()
+
+	for _, rt := range served {
+		if !slices.Contains(documented, rt) {
+			undocumented = append(undocumented, rt)
+		}
+	}
+
+	for _, rt := range documented {
+		if !slices.Contains(served, rt) {
+			unserved = append(unserved, rt)
+		}
+	}
+
+	return undocumented, unserved
+}
+
+// Operation returns the operation documented for the route.
+func (d *Document) Operation(method, path string) (*Operation, bool) {
+	paths, _ := d.root["paths"].(map[string]any)
+	item, ok := paths[path].(map[string]any)
+
+	if !ok {
+		return nil, false
+	}
+
+	op, ok := item[strings.ToLower(method)].(map[string]any)
+
+	if !ok {
+		return nil, false
+	}
+
+	operation := &Operation{doc: d}
+
+	// Path level parameters apply to every operation, unless the operation
+	// overrides them.
+	seen := map[string]bool{}
+
+	for _, list := range []any{op["parameters"], item["parameters"]} {
+		list, _ := list.([]any)
+
+		for _, param := range list {
+			param, ok := d.resolve(param).(map[string]any)
+
+			if !ok {
+				continue
+			}
+
+			key := fmt.Sprint(param["in"], ":", param["name"])
+
+			if !seen[key] {
+				seen[key] = true
+				operation.parameters = append(operation.parameters, param)
+			}
+		}
+	}
+
+	operation.requestBody, _ = d.resolve(op["requestBody"]).(map[string]any)
+
+	return operation, true
+}
+
+// resolve follows a local $ref like #/components/schemas/Movie.
+func (d *Document) resolve(v any) any {
+	for range 32 {
+		object, ok := v.(map[string]any)
+
+		if !ok {
+			return v
+		}
+
+		ref, ok := object["$ref"].(string)
+
+		if !ok {
+			return v
+		}
+
+		v = d.pointer(ref)
+	}
+
+	return nil
+}
+
+func (d *Document) pointer(ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+
+	if !ok {
+		return nil
+	}
+
+	var v any = d.root
+
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		object, ok := v.(map[string]any)
+
+		if !ok {
+			return nil
+		}
+
+		v = object[token]
+	}
+
+	return v
+}
@@ -0,0 +1,376 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Operation is a documented endpoint, with its parameters and request body.
+type Operation struct {
+	doc         *Document
+	parameters  []map[string]any
+	requestBody map[string]any
+}
+
+// HasRequestBody reports whether the operation takes a request body.
+func (op *Operation) HasRequestBody() bool {
+	return op.requestBody != nil
+}
+
+// Validate checks the query string, headers and body of a request against the
+// operation. It returns a message per invalid parameter or body field, keyed like
+// the API's own validation errors: the parameter name, or the dotted path of the
+// body field. Path parameters are left to the handlers, which answer 404 for ids
+// that don't exist.
+//
+// Validate supports the subset of JSON Schema the documents use: $ref, type,
+// enum, properties, required, additionalProperties, items, the numeric, length
+// and item count limits, uniqueItems, pattern, oneOf, anyOf and allOf. Formats are
+// annotations only.
+func (op *Operation) Validate(r *http.Request, body []byte) map[string]string {
+	errs := map[string]string{}
+
+	query := r.URL.Query()
+
+	for _, param := range op.parameters {
+		name, _ := param["name"].(string)
+		required, _ := param["required"].(bool)
+
+		var value string
+		var present bool
+
+		switch param["in"] {
+		case "query":
+			present = query.Has(name)
+			value = query.Get(name)
+		case "header":
+			value = r.Header.Get(name)
+			present = value != ""
+		default:
+			continue
+		}
+
+		if !present {
+			if required {
+				errs[name] = "must be provided"
+			}
+			continue
+		}
+
+		schema := op.doc.resolve(param["schema"])
+		op.doc.validate(schema, op.doc.coerce(schema, value), name, errs)
+	}
+
+	if op.requestBody != nil {
+		op.validateBody(r, body, errs)
+	}
+
+	return errs
+}
+
+func (op *Operation) validateBody(r *http.Request, body []byte, errs map[string]string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required, _ := op.requestBody["required"].(bool); required {
+			errs["body"] = "must be provided"
+		}
+		return
+	}
+
+	// Clients often leave out the Content-Type of JSON bodies, and the API has
+	// always accepted that.
+	mediaType := "application/json"
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+
+	content, _ := op.requestBody["content"].(map[string]any)
+	media, ok := content[mediaType].(map[string]any)
+
+	if !ok {
+		types := make([]string, 0, len(content))
+
+		for contentType := range content {
+			types = append(types, contentType)
+		}
+
+		slices.Sort(types)
+
+		errs["Content-Type"] = fmt.Sprintf("must be one of %s", strings.Join(types, ", "))
+		return
+	}
+
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var value any
+
+	if err := dec.Decode(&value); err != nil {
+		errs["body"] = "must be valid JSON"
+		return
+	}
+
+	op.doc.validate(media["schema"], value, "", errs)
+}
+
+// coerce converts a parameter value to the JSON type its schema expects, so that
+// it can be validated like a body value. Values that don't convert are left as
+// strings for validate to reject.
+func (d *Document) coerce(schema any, value string) any {
+	s, _ := schema.(map[string]any)
+
+	for _, t := range schemaTypes(s) {
+		switch t {
+		case "integer", "number":
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				return json.Number(value)
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(value); err == nil {
+				return b
+			}
+		}
+	}
+
+	return value
+}
+
+func schemaTypes(s map[string]any) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := []string{}
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+
+	return nil
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return ""
+}
+
+func field(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func errorKey(path string) string {
+	if path == "" {
+		return "body"
+	}
+
+	return path
+}
+
+// validate checks value against the schema and records the first problem found at
+// each path in errs.
+func (d *Document) validate(schema any, value any, path string, errs map[string]string) {
+	s, ok := d.resolve(schema).(map[string]any)
+
+	if !ok {
+		return
+	}
+
+	fail := func(message string) {
+		key := errorKey(path)
+
+		if _, exists := errs[key]; !exists {
+			errs[key] = message
+		}
+	}
+
+	if types := schemaTypes(s); types != nil {
+		t := jsonType(value)
+
+		if !slices.Contains(types, t) && !(t == "integer" && slices.Contains(types, "number")) {
+			fail(fmt.Sprintf("must be of type %s", strings.Join(types, " or ")))
+			return
+		}
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+			values := make([]string, len(enum))
+
+			for i := range enum {
+				values[i] = fmt.Sprint(enum[i])
+			}
+
+			fail(fmt.Sprintf("must be one of %s", strings.Join(values, ", ")))
+			return
+		}
+	}
+
+	for _, sub := range asList(s["allOf"]) {
+		d.validate(sub, value, path, errs)
+	}
+
+	if alternatives := asList(s["oneOf"]); alternatives != nil && d.matching(alternatives, value) != 1 {
+		fail("does not match exactly one of the allowed forms")
+		return
+	}
+
+	if alternatives := asList(s["anyOf"]); alternatives != nil && d.matching(alternatives, value) == 0 {
+		fail("does not match any of the allowed forms")
+		return
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+
+		if limit, ok := number(s["minimum"]); ok && n < limit {
+			fail(fmt.Sprintf("must be at least %v", s["minimum"]))
+		}
+
+		if limit, ok := number(s["maximum"]); ok && n > limit {
+			fail(fmt.Sprintf("must be at most %v", s["maximum"]))
+		}
+
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+
+		if limit, ok := number(s["minLength"]); ok && length < limit {
+			fail(fmt.Sprintf("must be at least %v characters long", s["minLength"]))
+		}
+
+		if limit, ok := number(s["maxLength"]); ok && length > limit {
+			fail(fmt.Sprintf("must not be more than %v characters long", s["maxLength"]))
+		}
+
+		if pattern, ok := s["pattern"].(string); ok {
+			if rx, err := regexp.Compile(pattern); err == nil && !rx.MatchString(v) {
+				fail("has an invalid format")
+			}
+		}
+
+	case []any:
+		if limit, ok := number(s["minItems"]); ok && float64(len(v)) < limit {
+			fail(fmt.Sprintf("must contain at least %v items", s["minItems"]))
+		}
+
+		if limit, ok := number(s["maxItems"]); ok && float64(len(v)) > limit {
+			fail(fmt.Sprintf("must not contain more than %v items", s["maxItems"]))
+		}
+
+		if unique, _ := s["uniqueItems"].(bool); unique {
+			for i := range v {
+				if slices.ContainsFunc(v[:i], func(item any) bool { return reflect.DeepEqual(item, v[i]) }) {
+					fail("must not contain duplicate values")
+					break
+				}
+			}
+		}
+
+		if items, ok := s["items"]; ok {
+			for i := range v {
+				d.validate(items, v[i], fmt.Sprintf("%s[%d]", errorKey(path), i), errs)
+			}
+		}
+
+	case map[string]any:
+		properties, _ := s["properties"].(map[string]any)
+
+		for _, name := range asList(s["required"]) {
+			name, _ := name.(string)
+
+			if _, ok := v[name]; !ok {
+				key := field(path, name)
+
+				if _, exists := errs[key]; !exists {
+					errs[key] = "must be provided"
+				}
+			}
+		}
+
+		for name, item := range v {
+			if property, ok := properties[name]; ok {
+				d.validate(property, item, field(path, name), errs)
+				continue
+			}
+
+			switch additional := s["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					errs[field(path, name)] = "is not an allowed field"
+				}
+			case map[string]any:
+				d.validate(additional, item, field(path, name), errs)
+			}
+		}
+	}
+}
+
+// matching counts the schemas that value is valid against.
+func (d *Document) matching(schemas []any, value any) int {
+	n := 0
+
+	for _, schema := range schemas {
+		errs := map[string]string{}
+
+		if d.validate(schema, value, "", errs); len(errs) == 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+func asList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+
+	if !ok {
+		return 0, false
+	}
+
+	f, err := n.Float64()
+
+	return f, err == nil
+}
@@ -0,0 +1,157 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// equalJSON reports whether a and b encode the same value, whatever the key order.
+func equalJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+
+	var x, y any
+
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+
+	return reflect.DeepEqual(x, y)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace member", `{"title":"Moana","year":2016}`, `{"title":"Moana 2"}`, `{"title":"Moana 2","year":2016}`},
+		{"null deletes member", `{"title":"Moana","year":2016}`, `{"year":null}`, `{"title":"Moana"}`},
+		{"null deletes nested member", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{"null for missing member", `{"a":1}`, `{"b":null}`, `{"a":1}`},
+		{"merge nested objects", `{"a":{"b":1}}`, `{"a":{"c":2}}`, `{"a":{"b":1,"c":2}}`},
+		{"arrays are replaced", `{"genres":["drama","comedy"]}`, `{"genres":["action"]}`, `{"genres":["action"]}`},
+		{"object replaces scalar", `{"a":1}`, `{"a":{"b":null,"c":2}}`, `{"a":{"c":2}}`},
+		{"non-object patch replaces document", `{"a":1}`, `["x"]`, `["x"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+
+			if !equalJSON(t, got, []byte(tt.want)) {
+				t.Errorf("Merge() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeInvalidPatch(t *testing.T) {
+	_, err := Merge([]byte(`{}`), []byte(`{`))
+
+	if !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("Merge() error = %v, want ErrInvalidPatch", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add null", `{"a":1}`, `[{"op":"add","path":"/b","value":null}]`, `{"a":1,"b":null}`},
+		{"add at index", `{"g":["a","c"]}`, `[{"op":"add","path":"/g/1","value":"b"}]`, `{"g":["a","b","c"]}`},
+		{"append with dash", `{"g":["a"]}`, `[{"op":"add","path":"/g/-","value":"b"}]`, `{"g":["a","b"]}`},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/b"}]`, `{"a":1}`},
+		{"remove element", `{"g":["a","b","c"]}`, `[{"op":"remove","path":"/g/1"}]`, `{"g":["a","c"]}`},
+		{"remove last with dash", `{"g":["a","b","c"]}`, `[{"op":"remove","path":"/g/-"}]`, `{"g":["a","b"]}`},
+		{"replace element", `{"g":["a","b"]}`, `[{"op":"replace","path":"/g/0","value":"x"}]`, `{"g":["x","b"]}`},
+		{"move member", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`},
+		{"move to itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`},
+		{"copy member", `{"a":[1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":[1],"b":[1]}`},
+		{"copy into own child", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/a/c"}]`, `{"a":{"b":1,"c":{"b":1}}}`},
+		{"test passes", `{"a":{"b":[1,"x"]}}`, `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`, `{"a":{"b":[1,"x"]}}`},
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escaped tilde", `{"a~b":1}`, `[{"op":"remove","path":"/a~0b"}]`, `{}`},
+		{"tilde before one", `{"~1":1,"/":2}`, `[{"op":"remove","path":"/~01"}]`, `{"/":2}`},
+		{"operations apply in order", `{}`, `[{"op":"add","path":"/a","value":[]},{"op":"add","path":"/a/-","value":1},{"op":"test","path":"/a/0","value":1}]`, `{"a":[1]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if !equalJSON(t, got, []byte(tt.want)) {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  error
+	}{
+		{"not an array", `{}`, `{"op":"add"}`, ErrInvalidPatch},
+		{"unknown operation", `{}`, `[{"op":"frobnicate","path":"/a"}]`, ErrInvalidPatch},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, ErrInvalidPatch},
+		{"relative path", `{}`, `[{"op":"add","path":"a","value":1}]`, ErrInvalidPatch},
+		{"remove whole document", `{}`, `[{"op":"remove","path":""}]`, ErrInvalidPatch},
+		{"test value differs", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ErrTestFailed},
+		{"test type differs", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, ErrTestFailed},
+		{"test missing path", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, ErrPathNotFound},
+		{"move into own child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, ErrInvalidPatch},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, ErrPathNotFound},
+		{"remove missing member", `{}`, `[{"op":"remove","path":"/a"}]`, ErrPathNotFound},
+		{"add under missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, ErrPathNotFound},
+		{"index out of range", `{"g":["a"]}`, `[{"op":"remove","path":"/g/1"}]`, ErrPathNotFound},
+		{"leading zero index", `{"g":["a","b"]}`, `[{"op":"remove","path":"/g/01"}]`, ErrPathNotFound},
+		{"leading zero add index", `{"g":["a","b"]}`, `[{"op":"add","path":"/g/00","value":"x"}]`, ErrPathNotFound},
+		{"negative index", `{"g":["a"]}`, `[{"op":"remove","path":"/g/-1"}]`, ErrPathNotFound},
+		{"remove dash from empty array", `{"g":[]}`, `[{"op":"remove","path":"/g/-"}]`, ErrPathNotFound},
+		{"replace with dash", `{"g":["a"]}`, `[{"op":"replace","path":"/g/-","value":"b"}]`, ErrPathNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Apply() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// A failing operation fails the whole patch, leaving no partial result behind.
+func TestApplyIsAtomic(t *testing.T) {
+	got, err := Apply([]byte(`{"a":1}`), []byte(`[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`))
+
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("Apply() error = %v, want ErrTestFailed", err)
+	}
+
+	if got != nil {
+		t.Errorf("Apply() = %s, want nil", got)
+	}
+}
@@ -0,0 +1,173 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// encodeCSV writes the rows of a response. The rows are the first list in the
+// envelope, like the movies of a listing, or the first object when there is no
+// list. Other objects in the envelope, like the pagination metadata, don't fit the
+// table and are sent as X-<Key>-<Field> headers instead. Without any list or object
+// the envelope itself becomes the single row.
+func encodeCSV(out io.Writer, header http.Header, tree any) error {
+	root, ok := tree.(*object)
+
+	if !ok {
+		return writeRows(out, []any{tree})
+	}
+
+	var rows []any
+	rowsKey := ""
+
+	for _, key := range root.keys {
+		if list, ok := root.values[key].([]any); ok {
+			rows, rowsKey = list, key
+			break
+		}
+	}
+
+	if rowsKey == "" {
+		for _, key := range root.keys {
+			if _, ok := root.values[key].(*object); ok {
+				rows, rowsKey = []any{root.values[key]}, key
+				break
+			}
+		}
+	}
+
+	if rowsKey == "" {
+		return writeRows(out, []any{root})
+	}
+
+	for _, key := range root.keys {
+		if key == rowsKey {
+			continue
+		}
+
+		if o, ok := root.values[key].(*object); ok {
+			for _, field := range o.keys {
+				header.Set(fmt.Sprintf("X-%s-%s", headerWord(key), headerWord(field)), cell(o.values[field]))
+			}
+		}
+	}
+
+	return writeRows(out, rows)
+}
+
+// writeRows writes a header line with the union of the keys of all rows, in the
+// order they are first seen, then one line per row. Rows that aren't objects go in
+// a single "value" column.
+func writeRows(out io.Writer, rows []any) error {
+	columns := []string{}
+	seen := map[string]bool{}
+
+	for _, row := range rows {
+		o, ok := row.(*object)
+
+		if !ok {
+			o = &object{keys: []string{"value"}}
+		}
+
+		for _, key := range o.keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(out)
+
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		o, ok := row.(*object)
+
+		if !ok {
+			o = &object{keys: []string{"value"}, values: map[string]any{"value": row}}
+		}
+
+		record := make([]string, len(columns))
+
+		for i, column := range columns {
+			record[i] = rowCell(o.values[column])
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// cell formats a value for a CSV cell or header. Lists of plain values, like genres,
+// are joined with semicolons, and anything more nested is written as JSON.
+func cell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	case []any:
+		parts := make([]string, len(v))
+
+		for i := range v {
+			switch v[i].(type) {
+			case []any, *object:
+				js, _ := json.Marshal(v)
+				return string(js)
+			}
+
+			parts[i] = cell(v[i])
+		}
+
+		return strings.Join(parts, ";")
+	default:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+}
+
+// rowCell formats a value for a CSV row. Text that a spreadsheet would run as a
+// formula, starting with =, +, -, @, a tab or a carriage return, is prefixed with
+// a quote so that it's shown as text instead.
+func rowCell(value any) string {
+	text := cell(value)
+
+	if _, ok := value.(json.Number); ok {
+		return text
+	}
+
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+
+	return text
+}
+
+// headerWord turns a key like total_records into Total-Records.
+func headerWord(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || r == ' '
+	})
+
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + strings.ToLower(word[1:])
+	}
+
+	return strings.Join(words, "-")
+}
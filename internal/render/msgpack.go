@@ -0,0 +1,136 @@
+package render
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// encodeMsgPack writes the tree in the MessagePack format
+// (https://github.com/msgpack/msgpack/blob/master/spec.md). Numbers are encoded as
+// integers when they have no fraction, and as 64-bit floats otherwise.
+func encodeMsgPack(out io.Writer, tree any) error {
+	buf := []byte{}
+
+	buf, err := appendMsgPack(buf, tree)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(buf)
+
+	return err
+}
+
+func appendMsgPack(b []byte, value any) ([]byte, error) {
+	var err error
+
+	switch v := value.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+
+	case json.Number:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return appendMsgPackInt(b, i), nil
+		}
+
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(f)), nil
+
+	case string:
+		n := len(v)
+
+		switch {
+		case n < 32:
+			b = append(b, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+		}
+
+		return append(b, v...), nil
+
+	case []any:
+		n := len(v)
+
+		switch {
+		case n < 16:
+			b = append(b, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+		}
+
+		for _, item := range v {
+			if b, err = appendMsgPack(b, item); err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+
+	case *object:
+		n := len(v.keys)
+
+		switch {
+		case n < 16:
+			b = append(b, 0x80|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+		}
+
+		for _, key := range v.keys {
+			if b, err = appendMsgPack(b, key); err != nil {
+				return nil, err
+			}
+
+			if b, err = appendMsgPack(b, v.values[key]); err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("render: unexpected %T value", value)
+	}
+}
+
+// appendMsgPackInt uses the smallest integer encoding that fits i.
+func appendMsgPackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 127:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
@@ -0,0 +1,284 @@
+// Package render encodes API responses as JSON, CSV, XML or MessagePack, picking
+// the format from the request's Accept header.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Format struct {
+	Name        string
+	ContentType string
+	// aliases are other media types clients may ask for this format with.
+	aliases []string
+}
+
+var (
+	JSON    = Format{Name: "json", ContentType: "application/json"}
+	CSV     = Format{Name: "csv", ContentType: "text/csv", aliases: []string{"application/csv"}}
+	XML     = Format{Name: "xml", ContentType: "application/xml", aliases: []string{"text/xml"}}
+	MsgPack = Format{Name: "msgpack", ContentType: "application/msgpack", aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}}
+)
+
+// Formats are the supported formats, in order of preference when a client accepts
+// several of them equally.
+var Formats = []Format{JSON, CSV, XML, MsgPack}
+
+var ErrNotAcceptable = errors.New("not acceptable")
+
+func (f Format) matches(mediaType string) bool {
+	return mediaType == f.ContentType || slices.Contains(f.aliases, mediaType)
+}
+
+// Negotiate picks the response format. A non-empty override, the value of the
+// ?format= query string parameter, wins over the Accept header. Without either, or
+// when the client accepts anything, JSON is used.
+//
+// Each format gets the quality of the most specific media range that matches it,
+// so "application/json;q=0, */*" accepts anything but JSON, and a quality of 0
+// makes a format not acceptable.
+func Negotiate(accept, override string) (Format, error) {
+	if override != "" {
+		for _, f := range Formats {
+			if f.Name == override {
+				return f, nil
+			}
+		}
+		return Format{}, ErrNotAcceptable
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return JSON, nil
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQ := Format{}, 0.0
+
+	for _, f := range Formats {
+		q, specificity := 0.0, 0
+
+		for _, r := range ranges {
+			if s := r.matches(f); s > specificity || (s == specificity && s > 0 && r.q > q) {
+				q, specificity = r.q, s
+			}
+		}
+
+		// Formats come in order of preference, so only a strictly higher quality
+		// replaces an earlier match.
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	if bestQ == 0 {
+		return Format{}, ErrNotAcceptable
+	}
+
+	return best, nil
+}
+
+// mediaRange is an entry of an Accept header, like text/* or application/json.
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header, skipping entries it can't make sense of.
+func parseAccept(accept string) []mediaRange {
+	ranges := []mediaRange{}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+
+	return ranges
+}
+
+// matches returns how specifically the range matches the format: 3 for its media
+// type or an alias, 2 for type/* and 1 for */*, or 0 when it doesn't match.
+func (r mediaRange) matches(f Format) int {
+	switch {
+	case f.matches(r.mediaType):
+		return 3
+	case r.mediaType == "*/*":
+		return 1
+	case strings.HasSuffix(r.mediaType, "/*"):
+		prefix := strings.TrimSuffix(r.mediaType, "*")
+
+		if strings.HasPrefix(f.ContentType, prefix) {
+			return 2
+		}
+
+		for _, alias := range f.aliases {
+			if strings.HasPrefix(alias, prefix) {
+				return 2
+			}
+		}
+	}
+
+	return 0
+}
+
+// Encode writes v in the given format with the status code. Values go through their
+// JSON representation first, so custom JSON marshalers (like the "102 mins" runtime)
+// and json struct tags apply to every format.
+func Encode(w http.ResponseWriter, status int, format Format, v any) error {
+	js, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	tree, err := decodeTree(js)
+
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+
+	switch format.Name {
+	case JSON.Name:
+		buf.Write(js)
+		buf.WriteByte('\n')
+	case CSV.Name:
+		err = encodeCSV(buf, w.Header(), tree)
+	case XML.Name:
+		err = encodeXML(buf, tree)
+	case MsgPack.Name:
+		err = encodeMsgPack(buf, tree)
+	default:
+		err = fmt.Errorf("render: unknown format %q", format.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", format.ContentType)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+
+	return nil
+}
+
+// object is a decoded JSON object that remembers the order of its keys, so that
+// CSV columns and XML elements come out in the same order as the JSON fields.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(o.values[key])
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// decodeTree decodes JSON into nil, bool, json.Number, string, []any and *object
+// values.
+func decodeTree(js []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		o := &object{values: map[string]any{}}
+
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			o.keys = append(o.keys, key.(string))
+			o.values[key.(string)] = value
+		}
+
+		_, err = dec.Token()
+
+		return o, err
+
+	default:
+		a := []any{}
+
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			a = append(a, value)
+		}
+
+		_, err = dec.Token()
+
+		return a, err
+	}
+}
@@ -0,0 +1,328 @@
+package render
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		override string
+		want     Format
+		wantErr  error
+	}{
+		{"no accept header", "", "", JSON, nil},
+		{"anything", "*/*", "", JSON, nil},
+		{"exact type", "text/csv", "", CSV, nil},
+		{"alias", "text/xml", "", XML, nil},
+		{"parameters", "application/msgpack; charset=utf-8", "", MsgPack, nil},
+		{"type wildcard", "text/*", "", CSV, nil},
+		{"highest quality wins", "application/json;q=0.5, application/xml", "", XML, nil},
+		{"equal quality prefers earlier format", "application/xml, text/csv", "", CSV, nil},
+		{"q=0 excludes format from wildcard", "application/json;q=0, */*", "", CSV, nil},
+		{"q=0 excludes format from type wildcard", "text/csv;q=0, text/*", "", XML, nil},
+		{"specific range beats higher wildcard quality", "application/json;q=0.1, */*;q=0.9", "", CSV, nil},
+		{"specific range beats lower wildcard quality", "text/csv, */*;q=0.1", "", CSV, nil},
+		{"everything excluded", "*/*;q=0", "", Format{}, ErrNotAcceptable},
+		{"only unsupported types", "image/png", "", Format{}, ErrNotAcceptable},
+		{"invalid entries are skipped", "not a type, application/xml;q=2, text/csv", "", CSV, nil},
+		{"override", "application/json", "msgpack", MsgPack, nil},
+		{"unknown override", "", "yaml", Format{}, ErrNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(tt.accept, tt.override)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Negotiate() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got.Name != tt.want.Name {
+				t.Errorf("Negotiate() = %q, want %q", got.Name, tt.want.Name)
+			}
+		})
+	}
+}
+
+type testMovie struct {
+	ID      int64    `json:"id" xml:"id"`
+	Title   string   `json:"title" xml:"title"`
+	Year    int32    `json:"year,omitempty" xml:"year"`
+	Rating  float64  `json:"rating" xml:"rating"`
+	Genres  []string `json:"genres" xml:"genres>item"`
+	Watched bool     `json:"watched" xml:"watched"`
+}
+
+func TestEncodeXMLRoundTrip(t *testing.T) {
+	movies := []testMovie{
+		{ID: 1, Title: "Moana", Year: 2016, Rating: 7.6, Genres: []string{"animation", "adventure"}, Watched: true},
+		{ID: 2, Title: `Tom & Jerry <"The Movie">`, Rating: -1.5, Genres: []string{}},
+	}
+
+	w := httptest.NewRecorder()
+
+	err := Encode(w, 200, XML, map[string]any{"movies": movies})
+
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != XML.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, XML.ContentType)
+	}
+
+	var got struct {
+		XMLName xml.Name    `xml:"response"`
+		Movies  []testMovie `xml:"movies>item"`
+	}
+
+	if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v\n%s", err, w.Body)
+	}
+
+	// An empty list decodes as nil.
+	movies[1].Genres = nil
+
+	if !reflect.DeepEqual(got.Movies, movies) {
+		t.Errorf("decoded %+v, want %+v", got.Movies, movies)
+	}
+}
+
+func TestXMLName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"title", "title"},
+		{"runtime_mins", "runtime_mins"},
+		{"a b", "a_b"},
+		{"1st", "_1st"},
+		{"", "_"},
+		{"<x>", "_x_"},
+	}
+
+	for _, tt := range tests {
+		if got := xmlName(tt.key); got != tt.want {
+			t.Errorf("xmlName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeMsgPackRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	many := make([]any, 20)
+	keys := map[string]any{}
+
+	for i := range many {
+		many[i] = int64(i)
+		keys[fmt.Sprint("k", i)] = int64(i)
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{"null", nil, nil},
+		{"booleans", []bool{true, false}, []any{true, false}},
+		{"positive fixint", 127, int64(127)},
+		{"negative fixint", -32, int64(-32)},
+		{"int8", -33, int64(-33)},
+		{"int16", 300, int64(300)},
+		{"int32", -70000, int64(-70000)},
+		{"int64", int64(math.MaxInt64), int64(math.MaxInt64)},
+		{"float", 7.25, 7.25},
+		{"fixstr", "Moana", "Moana"},
+		{"str8", long[:40], long[:40]},
+		{"str16", long, long},
+		{"array16", many, many},
+		{"map16", keys, keys},
+		{"nested", map[string]any{"movie": map[string]any{"title": "Moana", "genres": []string{"animation"}}}, map[string]any{"movie": map[string]any{"title": "Moana", "genres": []any{"animation"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			if err := Encode(w, 200, MsgPack, tt.value); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			b := w.Body.Bytes()
+
+			got, err := decodeMsgPack(&b)
+
+			if err != nil {
+				t.Fatalf("decode error = %v", err)
+			}
+
+			if len(b) != 0 {
+				t.Errorf("%d bytes left over", len(b))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// decodeMsgPack decodes the subset of MessagePack that encodeMsgPack writes,
+// consuming the value from the front of b.
+func decodeMsgPack(b *[]byte) (any, error) {
+	next := func(n int) ([]byte, error) {
+		if len(*b) < n {
+			return nil, errors.New("unexpected end of input")
+		}
+
+		v := (*b)[:n]
+		*b = (*b)[n:]
+
+		return v, nil
+	}
+
+	h, err := next(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := h[0]
+
+	length := func(size int) (int, error) {
+		v, err := next(size)
+		if err != nil {
+			return 0, err
+		}
+
+		switch size {
+		case 1:
+			return int(v[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(v)), nil
+		default:
+			return int(binary.BigEndian.Uint32(v)), nil
+		}
+	}
+
+	str := func(n int) (any, error) {
+		v, err := next(n)
+		return string(v), err
+	}
+
+	array := func(n int) (any, error) {
+		a := make([]any, n)
+
+		for i := range a {
+			if a[i], err = decodeMsgPack(b); err != nil {
+				return nil, err
+			}
+		}
+
+		return a, nil
+	}
+
+	dict := func(n int) (any, error) {
+		m := make(map[string]any, n)
+
+		for range n {
+			key, err := decodeMsgPack(b)
+			if err != nil {
+				return nil, err
+			}
+
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key is %T", key)
+			}
+
+			if m[k], err = decodeMsgPack(b); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return dict(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		v, err := next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(v)), nil
+	case 0xd0:
+		v, err := next(1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int8(v[0])), nil
+	case 0xd1:
+		v, err := next(2)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(v))), nil
+	case 0xd2:
+		v, err := next(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(v))), nil
+	case 0xd3:
+		v, err := next(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(v)), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return str(n)
+	case 0xdc, 0xdd:
+		n, err := length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return array(n)
+	case 0xde, 0xdf:
+		n, err := length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return dict(n)
+	}
+
+	return nil, fmt.Errorf("unsupported type byte 0x%x", c)
+}
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// encodeXML writes the tree inside a <response> element. Object keys become
+// elements and list entries become <item> elements.
+func encodeXML(out io.Writer, tree any) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(out)
+
+	if err := encodeXMLElement(enc, "response", tree); err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	var err error
+
+	switch v := value.(type) {
+	case nil:
+	case *object:
+		for _, key := range v.keys {
+			if err = encodeXMLElement(enc, key, v.values[key]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err = encodeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case string:
+		err = enc.EncodeToken(xml.CharData(v))
+	case json.Number:
+		err = enc.EncodeToken(xml.CharData(v.String()))
+	case bool:
+		err = enc.EncodeToken(xml.CharData(fmt.Sprint(v)))
+	default:
+		err = fmt.Errorf("render: unexpected %T value", value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName makes a key usable as an element name. Keys like validation error fields
+// are free-form, so anything that isn't allowed in a name becomes an underscore.
+func xmlName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, key)
+
+	if name == "" || !(unicode.IsLetter(rune(name[0])) || name[0] == '_') {
+		name = "_" + name
+	}
+
+	return name
+}
@@ -0,0 +1,285 @@
+// Package rotate writes to a file that is rotated when it gets too big or too old,
+// keeping a limited number of old files around.
+package rotate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the time a file was rotated at, in the names of backups
+// like access-2026-10-18T21-38-07.000.log. It sorts in time order.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+type Options struct {
+	// MaxSize is the size in bytes a file is rotated at. Zero means no limit.
+	MaxSize int64
+	// Interval rotates the file at every multiple of it since the zero time, in
+	// UTC, so 24h rotates at midnight. Zero means no time-based rotation.
+	Interval time.Duration
+	// MaxBackups is how many rotated files are kept, and MaxAge for how long.
+	// Zero means no limit.
+	MaxBackups int
+	MaxAge     time.Duration
+}
+
+// Writer is an io.WriteCloser that appends to a file and rotates it. It's safe
+// for concurrent use, and every Write goes to a single file, so lines are never
+// split between files.
+type Writer struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	nextCut time.Time
+
+	// now is the clock, which tests replace.
+	now func() time.Time
+}
+
+// Open opens the file at path for appending, creating it and its directory if
+// needed. A file left over from before that is due for rotation is rotated first.
+func Open(path string, opts Options) (*Writer, error) {
+	return open(path, opts, time.Now)
+}
+
+func open(path string, opts Options, now func() time.Time) (*Writer, error) {
+	w := &Writer{path: path, opts: opts, now: now}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case opts.Interval > 0 && info.ModTime().Before(w.now().UTC().Truncate(opts.Interval)):
+		// The file was last written in an earlier interval.
+		if err := w.backup(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = w.open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+
+	if w.opts.Interval > 0 {
+		w.nextCut = w.now().UTC().Truncate(w.opts.Interval).Add(w.opts.Interval)
+	}
+
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	due := w.opts.Interval > 0 && !w.now().Before(w.nextCut)
+
+	// A write bigger than MaxSize still goes to a file of its own rather than
+	// being split.
+	if due || (w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// Rotate closes the current file, renames it to a backup and starts a new one.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	return w.rotate()
+}
+
+func (w *Writer) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+
+	if err != nil {
+		return err
+	}
+
+	err = w.backup()
+
+	if err != nil {
+		return err
+	}
+
+	return w.open()
+}
+
+// backup renames the file to a backup and removes the backups that are no longer
+// kept.
+func (w *Writer) backup() error {
+	err := os.Rename(w.path, w.backupName(w.now()))
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return w.removeOld()
+}
+
+func (w *Writer) backupName(t time.Time) string {
+	dir, prefix, ext := w.nameParts()
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, t.UTC().Format(backupTimeFormat), ext))
+}
+
+func (w *Writer) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(w.path)
+	base := filepath.Base(w.path)
+	ext = filepath.Ext(base)
+
+	return dir, strings.TrimSuffix(base, ext), ext
+}
+
+type backup struct {
+	path string
+	time time.Time
+}
+
+// Backups returns the paths of the rotated files, newest first.
+func (w *Writer) Backups() ([]string, error) {
+	backups, err := w.backups()
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(backups))
+
+	for i, b := range backups {
+		paths[i] = b.path
+	}
+
+	return paths, nil
+}
+
+func (w *Writer) backups() ([]backup, error) {
+	dir, prefix, ext := w.nameParts()
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !strings.HasPrefix(name, prefix+"-") || !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix+"-"), ext)
+
+		t, err := time.Parse(backupTimeFormat, stamp)
+
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{filepath.Join(dir, name), t})
+	}
+
+	slices.SortFunc(backups, func(a, b backup) int {
+		return b.time.Compare(a.time)
+	})
+
+	return backups, nil
+}
+
+func (w *Writer) removeOld() error {
+	if w.opts.MaxBackups <= 0 && w.opts.MaxAge <= 0 {
+		return nil
+	}
+
+	backups, err := w.backups()
+
+	if err != nil {
+		return err
+	}
+
+	cutoff := w.now().Add(-w.opts.MaxAge)
+
+	var errs []error
+
+	for i, b := range backups {
+		tooMany := w.opts.MaxBackups > 0 && i >= w.opts.MaxBackups
+		tooOld := w.opts.MaxAge > 0 && b.time.Before(cutoff)
+
+		if tooMany || tooOld {
+			errs = append(errs, os.Remove(b.path))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+
+	return err
+}
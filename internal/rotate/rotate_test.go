@@ -0,0 +1,249 @@
+package rotate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// clock is a fake time that only moves when a test says so.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newClock() *clock {
+	return &clock{t: time.Date(2026, time.October, 18, 10, 30, 0, 0, time.UTC)}
+}
+
+func openTest(t *testing.T, c *clock, opts Options) (*Writer, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+
+	w, err := open(path, opts, c.now)
+
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	t.Cleanup(func() { w.Close() })
+
+	return w, path
+}
+
+func write(t *testing.T, w *Writer, s string) {
+	t.Helper()
+
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+// backups returns the contents of the backups, newest first.
+func backups(t *testing.T, w *Writer) []string {
+	t.Helper()
+
+	paths, err := w.Backups()
+
+	if err != nil {
+		t.Fatalf("Backups() error = %v", err)
+	}
+
+	contents := []string{}
+
+	for _, path := range paths {
+		contents = append(contents, readFile(t, path))
+	}
+
+	return contents
+}
+
+func TestRotateOnSize(t *testing.T) {
+	c := newClock()
+	w, path := openTest(t, c, Options{MaxSize: 10})
+
+	write(t, w, "one\n")
+	write(t, w, "two\n")
+
+	c.advance(time.Second)
+
+	// 12 bytes would go over MaxSize.
+	write(t, w, "three\n")
+
+	c.advance(time.Second)
+
+	// A write bigger than MaxSize gets a file of its own, unsplit.
+	write(t, w, "a very long line\n")
+
+	if got, want := readFile(t, path), "a very long line\n"; got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+
+	if got, want := backups(t, w), []string{"three\n", "one\ntwo\n"}; !slices.Equal(got, want) {
+		t.Errorf("backups = %q, want %q", got, want)
+	}
+}
+
+func TestRotateOnInterval(t *testing.T) {
+	c := newClock()
+	w, path := openTest(t, c, Options{Interval: time.Hour})
+
+	write(t, w, "10:30\n")
+
+	c.advance(29 * time.Minute)
+	write(t, w, "10:59\n")
+
+	c.advance(time.Minute)
+	write(t, w, "11:00\n")
+
+	if got, want := readFile(t, path), "11:00\n"; got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+
+	if got, want := backups(t, w), []string{"10:30\n10:59\n"}; !slices.Equal(got, want) {
+		t.Errorf("backups = %q, want %q", got, want)
+	}
+
+	// The backup is named after the time it was rotated at.
+	paths, _ := w.Backups()
+
+	if got, want := filepath.Base(paths[0]), "access-2026-10-18T11-00-00.000.log"; got != want {
+		t.Errorf("backup name = %q, want %q", got, want)
+	}
+}
+
+func TestRotateOnOpen(t *testing.T) {
+	c := newClock()
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Written earlier in the current interval: appended to.
+	write("10:10\n", c.t.Add(-20*time.Minute))
+
+	w, err := open(path, Options{Interval: time.Hour}, c.now)
+
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	w.Close()
+
+	if got := backups(t, w); len(got) != 0 {
+		t.Errorf("backups = %q, want none", got)
+	}
+
+	// Written in the previous interval: rotated.
+	write("09:50\n", c.t.Add(-40*time.Minute))
+
+	w, err = open(path, Options{Interval: time.Hour}, c.now)
+
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	defer w.Close()
+
+	if got := readFile(t, path); got != "" {
+		t.Errorf("file = %q, want it empty", got)
+	}
+
+	if got, want := backups(t, w), []string{"09:50\n"}; !slices.Equal(got, want) {
+		t.Errorf("backups = %q, want %q", got, want)
+	}
+}
+
+func TestMaxBackups(t *testing.T) {
+	c := newClock()
+	w, _ := openTest(t, c, Options{MaxBackups: 2})
+
+	for _, s := range []string{"1", "2", "3", "4"} {
+		write(t, w, s)
+
+		c.advance(time.Second)
+
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+	}
+
+	if got, want := backups(t, w), []string{"4", "3"}; !slices.Equal(got, want) {
+		t.Errorf("backups = %q, want %q", got, want)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	c := newClock()
+	w, _ := openTest(t, c, Options{MaxAge: time.Hour})
+
+	for _, s := range []string{"1", "2"} {
+		write(t, w, s)
+
+		c.advance(time.Minute)
+
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+	}
+
+	c.advance(time.Hour)
+	write(t, w, "3")
+
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	// The backup of "1" is 61 minutes old, and the one of "2" 60.
+	if got, want := backups(t, w), []string{"3", "2"}; !slices.Equal(got, want) {
+		t.Errorf("backups = %q, want %q", got, want)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	w, _ := openTest(t, newClock(), Options{})
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := w.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write() error = %v, want os.ErrClosed", err)
+	}
+
+	if err := w.Rotate(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Rotate() error = %v, want os.ErrClosed", err)
+	}
+}
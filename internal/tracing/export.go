@@ -0,0 +1,296 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Resource describes the process that recorded the spans.
+type Resource struct {
+	Attributes map[string]any
+}
+
+// Exporter sends finished spans somewhere. Export is called from a single
+// goroutine, one batch at a time.
+type Exporter interface {
+	Export(ctx context.Context, resource Resource, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// WriterExporter writes every span as a line of JSON, for reading traces locally
+// without a collector.
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterExporter returns an exporter that writes to w, like os.Stdout.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter returns an exporter that appends to the file at path, creating
+// it if needed.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+type jsonSpan struct {
+	TraceID       string         `json:"trace_id"`
+	SpanID        string         `json:"span_id"`
+	ParentSpanID  string         `json:"parent_span_id,omitempty"`
+	Name          string         `json:"name"`
+	Kind          string         `json:"kind"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	DurationMs    float64        `json:"duration_ms"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Events        []jsonEvent    `json:"events,omitempty"`
+	Status        string         `json:"status"`
+	StatusMessage string         `json:"status_message,omitempty"`
+	Service       any            `json:"service"`
+}
+
+type jsonEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func (e *WriterExporter) Export(ctx context.Context, resource Resource, spans []SpanData) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+
+	for _, span := range spans {
+		js := jsonSpan{
+			TraceID:       span.Context.TraceID.String(),
+			SpanID:        span.Context.SpanID.String(),
+			Name:          span.Name,
+			Kind:          span.Kind.String(),
+			Start:         span.Start.UTC(),
+			End:           span.End.UTC(),
+			DurationMs:    float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+			Attributes:    span.Attributes,
+			Status:        span.Status.String(),
+			StatusMessage: span.StatusMessage,
+			Service:       resource.Attributes["service.name"],
+		}
+
+		if span.Parent.IsValid() {
+			js.ParentSpanID = span.Parent.String()
+		}
+
+		for _, event := range span.Events {
+			js.Events = append(js.Events, jsonEvent{event.Name, event.Time.UTC(), event.Attributes})
+		}
+
+		err := enc.Encode(js)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := e.w.Write(buf.Bytes())
+
+	return err
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.closer == nil {
+		return nil
+	}
+
+	return e.closer.Close()
+}
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	default:
+		return "unset"
+	}
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector with OTLP over HTTP, in
+// the JSON encoding (https://opentelemetry.io/docs/specs/otlp/#otlphttp).
+type OTLPExporter struct {
+	endpoint string
+	headers  http.Header
+	client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter that posts to endpoint, the full URL of the
+// traces endpoint, like http://localhost:4318/v1/traces. The headers are sent with
+// every request, for collectors that need an API key.
+func NewOTLPExporter(endpoint string, headers http.Header) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, resource Resource, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(resource, spans))
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	for key, values := range e.headers {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("tracing: collector responded %s", res.Status)
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// otlpRequest builds an ExportTraceServiceRequest. In the JSON encoding ids are
+// hex, 64-bit integers are strings and enums are numbers.
+func otlpRequest(resource Resource, spans []SpanData) map[string]any {
+	otlpSpans := make([]map[string]any, 0, len(spans))
+
+	for _, span := range spans {
+		s := map[string]any{
+			"traceId":           span.Context.TraceID.String(),
+			"spanId":            span.Context.SpanID.String(),
+			"name":              span.Name,
+			"kind":              int(span.Kind),
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status":            map[string]any{"code": int(span.Status), "message": span.StatusMessage},
+		}
+
+		if span.Parent.IsValid() {
+			s["parentSpanId"] = span.Parent.String()
+		}
+
+		if len(span.Events) > 0 {
+			events := make([]map[string]any, 0, len(span.Events))
+
+			for _, event := range span.Events {
+				events = append(events, map[string]any{
+					"name":         event.Name,
+					"timeUnixNano": strconv.FormatInt(event.Time.UnixNano(), 10),
+					"attributes":   otlpAttributes(event.Attributes),
+				})
+			}
+
+			s["events"] = events
+		}
+
+		otlpSpans = append(otlpSpans, s)
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{"attributes": otlpAttributes(resource.Attributes)},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": "kyawzayarwin.com/greenlight/internal/tracing"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attributes map[string]any) []map[string]any {
+	list := make([]map[string]any, 0, len(attributes))
+
+	for key, value := range attributes {
+		list = append(list, map[string]any{"key": key, "value": otlpValue(value)})
+	}
+
+	return list
+}
+
+func otlpValue(value any) map[string]any {
+	switch v := value.(type) {
+	case string:
+		return map[string]any{"stringValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	case int:
+		return map[string]any{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int32:
+		return map[string]any{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	case []string:
+		values := make([]map[string]any, 0, len(v))
+
+		for _, s := range v {
+			values = append(values, map[string]any{"stringValue": s})
+		}
+
+		return map[string]any{"arrayValue": map[string]any{"values": values}}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,495 @@
+// Package tracing records spans compatible with OpenTelemetry and propagates
+// trace context with the W3C traceparent header
+// (https://www.w3.org/TR/trace-context/).
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// TraceID identifies every span of a trace.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within its trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats the span context as a traceparent header value, like
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value. It returns false when the
+// value is malformed or has an all-zero trace or span id, in which case the
+// header has to be ignored and a new trace started.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+
+	// version-traceid-spanid-flags. Later versions may append fields, which
+	// aren't understood but don't make the header invalid.
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, false
+	}
+
+	if !isLowerHex(s[0:2]) {
+		return sc, false
+	}
+
+	version, _ := hex.DecodeString(s[0:2])
+
+	if version[0] == 0xff || (version[0] == 0 && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return sc, false
+	}
+
+	if !isLowerHex(s[3:35]) || !isLowerHex(s[36:52]) || !isLowerHex(s[53:55]) {
+		return sc, false
+	}
+
+	hex.Decode(sc.TraceID[:], []byte(s[3:35]))
+	hex.Decode(sc.SpanID[:], []byte(s[36:52]))
+
+	flags, _ := hex.DecodeString(s[53:55])
+	sc.Sampled = flags[0]&0x01 == 1
+
+	return sc, sc.IsValid()
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Kind says what part a span plays in the trace, like in OpenTelemetry.
+type Kind int
+
+const (
+	KindInternal Kind = iota + 1
+	KindServer
+	KindClient
+)
+
+// Status is the outcome of a span. Spans are unset unless they record an error.
+type Status int
+
+const (
+	StatusUnset Status = iota
+	StatusOK
+	StatusError
+)
+
+// Event is something that happened during a span, like an error.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// SpanData is a finished span, as handed to an Exporter.
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	Context       SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	Events        []Event
+	Status        Status
+	StatusMessage string
+}
+
+// Span is an operation being timed. All methods do nothing on a nil span, which is
+// what Start returns when there's no trace to add the span to.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the context to propagate to the span's children.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.data.Context
+}
+
+// SetName renames the span, for when a better name is only known once it has
+// started, like the route that matched a request.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended {
+		s.data.Name = name
+	}
+}
+
+// SetAttribute sets an attribute of the span. Values should be strings, bools,
+// integers or floats.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The attributes of an ended span belong to the exporter.
+	if !s.ended {
+		s.data.Attributes[key] = value
+	}
+}
+
+// RecordError marks the span as failed with err. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+
+	s.data.Events = append(s.data.Events, Event{
+		Name:       "exception",
+		Time:       time.Now(),
+		Attributes: map[string]any{"exception.type": fmt.Sprintf("%T", err), "exception.message": err.Error()},
+	})
+
+	s.data.Status = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// SetStatus sets the status of the span, overriding any recorded error.
+func (s *Span) SetStatus(status Status, message string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended {
+		s.data.Status = status
+		s.data.StatusMessage = message
+	}
+}
+
+// End finishes the span and queues it for export. Calls after the first are
+// ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.Context.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+type spanContextKey struct{}
+
+type remoteContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx holding span, which new spans started
+// from the context become children of.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a copy of ctx holding a span context received
+// from another process, which the next span Tracer.Start starts becomes a child of.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// Start starts a child of the span in ctx. Without a span in ctx, it returns ctx
+// and a nil span, so code can be traced without knowing whether tracing is on.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+
+	if parent == nil {
+		return ctx, nil
+	}
+
+	return parent.tracer.Start(ctx, name, KindInternal)
+}
+
+// Tracer starts spans and exports them in batches, in the background.
+type Tracer struct {
+	attributes map[string]any
+	exporter   Exporter
+	ratio      float64
+	onError    func(err error)
+
+	queue chan SpanData
+	done  chan struct{}
+	stop  chan struct{}
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+// Options configures a Tracer.
+type Options struct {
+	// Service is reported as the service.name resource attribute.
+	Service string
+	// Attributes are further resource attributes, like service.version.
+	Attributes map[string]any
+	// SampleRatio is the fraction of new traces that are recorded, from 0 to 1.
+	// Traces started elsewhere are recorded when the caller sampled them.
+	SampleRatio float64
+	// BatchSize is the most spans exported at once, and FlushInterval how long a
+	// span waits for its batch to fill up.
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize is how many finished spans can wait to be exported. Spans ended
+	// when the queue is full are dropped.
+	QueueSize int
+	// OnError is called with export errors, which are otherwise ignored.
+	OnError func(err error)
+}
+
+// New returns a Tracer that exports to exporter until Shutdown is called.
+func New(exporter Exporter, opts Options) *Tracer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 2048
+	}
+
+	attributes := map[string]any{"service.name": opts.Service}
+
+	for key, value := range opts.Attributes {
+		attributes[key] = value
+	}
+
+	t := &Tracer{
+		attributes: attributes,
+		exporter:   exporter,
+		ratio:      opts.SampleRatio,
+		onError:    opts.OnError,
+		queue:      make(chan SpanData, opts.QueueSize),
+		done:       make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+
+	go t.run(opts.BatchSize, opts.FlushInterval)
+
+	return t
+}
+
+// Start starts a span of the given kind. It's a child of the span in ctx, or of
+// the remote parent in ctx, or else the root of a new trace. The returned context
+// holds the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Start:      time.Now(),
+			Attributes: make(map[string]any),
+		},
+	}
+
+	switch parent := SpanFromContext(ctx); {
+	case parent != nil:
+		span.data.Context = parent.SpanContext()
+		span.data.Parent = parent.SpanContext().SpanID
+	default:
+		if remote, ok := ctx.Value(remoteContextKey{}).(SpanContext); ok && remote.IsValid() {
+			span.data.Context = remote
+			span.data.Parent = remote.SpanID
+		} else {
+			rand.Read(span.data.Context.TraceID[:])
+			span.data.Context.Sampled = t.sample(span.data.Context.TraceID)
+		}
+	}
+
+	rand.Read(span.data.Context.SpanID[:])
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// sample decides on the trace id alone, so that every process that samples by
+// ratio agrees on a trace.
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.ratio >= 1:
+		return true
+	case t.ratio <= 0:
+		return false
+	}
+
+	return binary.BigEndian.Uint64(id[8:])>>1 < uint64(t.ratio*math.MaxInt64)
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		t.mu.Lock()
+		t.dropped++
+		t.mu.Unlock()
+	}
+}
+
+// Dropped returns the number of spans dropped because the queue was full.
+func (t *Tracer) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+func (t *Tracer) run(batchSize int, interval time.Duration) {
+	defer close(t.done)
+
+	batch := make([]SpanData, 0, batchSize)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// A batch that fails to export is dropped rather than retried, so that a
+		// collector that's down doesn't hold spans in memory.
+		err := t.exporter.Export(ctx, Resource{Attributes: t.attributes}, batch)
+
+		if err != nil && t.onError != nil {
+			t.onError(err)
+		}
+
+		batch = make([]SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case data := <-t.queue:
+					batch = append(batch, data)
+
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the spans that are queued and stops the tracer. Spans ended
+// afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return t.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,3 @@
+-- Grants access to the debug endpoints of the admin listener.
+INSERT INTO permissions (code)
+VALUES ('admin:debug');
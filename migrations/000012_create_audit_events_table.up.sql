@@ -0,0 +1,38 @@
+-- Security events, like logins and permission denials. Users aren't foreign keys,
+-- as events outlive the users they're about.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(6) with time zone NOT NULL,
+    action text NOT NULL,
+    outcome text NOT NULL,
+    actor_id bigint,
+    subject_id bigint,
+    ip text NOT NULL,
+    user_agent text NOT NULL,
+    request_id text NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}',
+    -- hash is the SHA-256 of prev_hash, the hash of the previous event, and of
+    -- this event, so that changing or removing an event breaks the chain.
+    prev_hash text NOT NULL,
+    hash text NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_subject_id_idx ON audit_events (subject_id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+
+-- The table is append-only: events can't be changed or removed, short of
+-- dropping the trigger first.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (code)
+VALUES ('admin:audit');
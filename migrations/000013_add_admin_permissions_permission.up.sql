@@ -0,0 +1,3 @@
+-- Grants access to the endpoints that grant and revoke permissions.
+INSERT INTO permissions (code)
+VALUES ('admin:permissions');
@@ -0,0 +1,407 @@
+// Package client is a Go client for the Greenlight API.
+//
+//	c, err := client.New("https://greenlight.example.com",
+//		client.WithCredentials("alice@example.com", "pa55word"))
+//
+//	for movie, err := range c.Movies.All(ctx, client.ListMoviesParams{Genres: []string{"drama"}}) {
+//		...
+//	}
+//
+// The client talks to v1 of the API, so the JSON of its types matches the API's
+// data types, runtimes written as "102 mins" included. With credentials it gets an
+// authentication token on the first request that needs one and gets a new one when
+// the token expires. Requests that fail with 429 or a 5xx status are retried with
+// exponential backoff when that's safe.
+//
+// New users get movies:read. Administrators with the admin:permissions permission
+// grant and revoke the others with Permissions.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a Greenlight API client. It's safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userAgent  string
+
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// mu guards the authentication token. It's held while a new token is fetched,
+	// so that concurrent requests wait for one token instead of each getting one.
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	email       string
+	password    string
+
+	Movies      *MoviesService
+	Users       *UsersService
+	Tokens      *TokensService
+	Permissions *PermissionsService
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the client send requests with hc instead of a client with a
+// 30 second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken makes the client authenticate with an existing token. The token isn't
+// renewed unless credentials are given too.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithCredentials makes the client get its own authentication tokens with the
+// email and password of a user, and get a new one whenever the current one expires
+// or is rejected.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// WithRetry sets how many times a failed request is retried and the backoff before
+// the first retry, which doubles on every retry up to max. A maxRetries of zero
+// turns retries off.
+func WithRetry(maxRetries int, min, max time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns a client for the API at baseURL, like https://greenlight.example.com.
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base URL %q must be an http or https URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "greenlight-go-client",
+		maxRetries: 3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	c.Movies = &MoviesService{client: c}
+	c.Users = &UsersService{client: c}
+	c.Tokens = &TokensService{client: c}
+	c.Permissions = &PermissionsService{client: c}
+
+	return c, nil
+}
+
+// SetToken replaces the authentication token. A zero expiry means the token is
+// used until the API rejects it.
+func (c *Client) SetToken(token string, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+	c.tokenExpiry = expiry
+}
+
+// tokenExpirySkew renews tokens a little before they expire, so that a token
+// doesn't run out while a request is on its way.
+const tokenExpirySkew = time.Minute
+
+// authToken returns the token to send with an authenticated request, getting a new
+// one first if needed. An empty token means the request is sent anonymously.
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fresh := c.token != "" && (c.tokenExpiry.IsZero() || time.Until(c.tokenExpiry) > tokenExpirySkew)
+
+	if fresh || c.email == "" {
+		return c.token, nil
+	}
+
+	token, err := c.Tokens.Authenticate(ctx, c.email, c.password)
+
+	if err != nil {
+		return "", fmt.Errorf("client: getting an authentication token: %w", err)
+	}
+
+	c.token = token.Plaintext
+	c.tokenExpiry = token.Expiry
+
+	return c.token, nil
+}
+
+// dropToken forgets a token the API rejected, unless another request already
+// replaced it. It reports whether a new token can be fetched.
+func (c *Client) dropToken(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token = ""
+		c.tokenExpiry = time.Time{}
+	}
+
+	return c.email != ""
+}
+
+// request describes an API call.
+type request struct {
+	method string
+	// path is relative to the API version, like /movies/1.
+	path   string
+	query  url.Values
+	body   any
+	header http.Header
+	// auth sends the authentication token.
+	auth bool
+	// idempotent marks POST endpoints that deduplicate requests with an
+	// Idempotency-Key header, which makes them safe to retry.
+	idempotent bool
+	// responseHeader, when set, receives the headers of the final response.
+	responseHeader *http.Header
+}
+
+// do sends the request and decodes the response envelope into dst, which may be
+// nil. Error responses are returned as an *Error.
+func (c *Client) do(ctx context.Context, req request, dst any) error {
+	var body []byte
+
+	if req.body != nil {
+		var err error
+
+		body, err = json.Marshal(req.body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	header := req.header.Clone()
+
+	if header == nil {
+		header = http.Header{}
+	}
+
+	if req.idempotent && header.Get("Idempotency-Key") == "" {
+		header.Set("Idempotency-Key", newIdempotencyKey())
+	}
+
+	retryable := req.method == http.MethodGet || req.method == http.MethodPut ||
+		req.method == http.MethodDelete || header.Get("Idempotency-Key") != ""
+
+	reauthenticated := false
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := c.newRequest(ctx, req, header, body)
+
+		if err != nil {
+			return err
+		}
+
+		token := ""
+
+		if req.auth {
+			token, err = c.authToken(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			if token != "" {
+				httpReq.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+
+		res, err := c.httpClient.Do(httpReq)
+
+		if err != nil {
+			if ctx.Err() != nil || !retryable || attempt >= c.maxRetries {
+				return err
+			}
+
+			if err := c.wait(ctx, attempt, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// A rejected token is replaced once, without counting as a retry.
+		if res.StatusCode == http.StatusUnauthorized && token != "" && !reauthenticated && c.dropToken(token) {
+			drain(res)
+			reauthenticated = true
+			attempt--
+			continue
+		}
+
+		if retryable && attempt < c.maxRetries && retryableStatus(res.StatusCode) {
+			drain(res)
+
+			if err := c.wait(ctx, attempt, res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.responseHeader != nil {
+			*req.responseHeader = res.Header
+		}
+
+		return decodeResponse(res, dst)
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, req request, header http.Header, body []byte) (*http.Request, error) {
+	u := c.baseURL.JoinPath("v1", req.path)
+
+	if len(req.query) > 0 {
+		u.RawQuery = req.query.Encode()
+	}
+
+	var bodyReader io.Reader
+
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), bodyReader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header = header.Clone()
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+
+	if body != nil && httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	return httpReq, nil
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// wait sleeps before a retry. It honours a Retry-After header in seconds, and
+// otherwise backs off exponentially with full jitter.
+func (c *Client) wait(ctx context.Context, attempt int, res *http.Response) error {
+	delay := time.Duration(0)
+
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+	}
+
+	if delay == 0 {
+		backoff := float64(c.minBackoff) * math.Pow(2, float64(attempt))
+		delay = time.Duration(min(backoff, float64(c.maxBackoff)))
+		delay = time.Duration(mrand.Int64N(int64(delay) + 1))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// drain reads the rest of a response that won't be used, so that the connection
+// can be reused.
+func drain(res *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+	res.Body.Close()
+}
+
+func decodeResponse(res *http.Response, dst any) error {
+	defer drain(res)
+
+	if res.StatusCode >= 400 {
+		return newError(res)
+	}
+
+	if dst == nil {
+		return nil
+	}
+
+	err := json.NewDecoder(res.Body).Decode(dst)
+
+	if err != nil {
+		return fmt.Errorf("client: decoding the %s response: %w", res.Request.URL.Path, err)
+	}
+
+	return nil
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// joinList writes a list query parameter as the API reads it, separated by commas.
+func joinList(values []string) string {
+	return strings.Join(values, ",")
+}
+
+var errNoToken = errors.New("client: the API returned no token")
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Errors for the API's error statuses, for use with errors.Is:
+//
+//	if errors.Is(err, client.ErrNotFound) { ... }
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrNotFound             = errors.New("not found")
+	ErrNotAcceptable        = errors.New("not acceptable")
+	ErrConflict             = errors.New("conflict")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrValidation           = errors.New("validation failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrRateLimited          = errors.New("rate limited")
+	ErrServer               = errors.New("server error")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:           ErrBadRequest,
+	http.StatusUnauthorized:         ErrUnauthorized,
+	http.StatusForbidden:            ErrForbidden,
+	http.StatusNotFound:             ErrNotFound,
+	http.StatusNotAcceptable:        ErrNotAcceptable,
+	http.StatusConflict:             ErrConflict,
+	http.StatusPreconditionFailed:   ErrPreconditionFailed,
+	http.StatusUnprocessableEntity:  ErrValidation,
+	http.StatusPreconditionRequired: ErrPreconditionRequired,
+	http.StatusTooManyRequests:      ErrRateLimited,
+}
+
+// Error is an error response of the API. The API sends either a message or, when
+// the request failed validation, a message per invalid field.
+type Error struct {
+	StatusCode int
+	// Message is the error message, or empty when the error has Fields.
+	Message string
+	// Fields maps the invalid fields of a request to what's wrong with them.
+	Fields map[string]string
+	// Body is the raw error envelope, for errors that carry more than the message,
+	// like the results of a failed bulk operation.
+	Body json.RawMessage
+	// RequestID identifies the request in the API's logs.
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) > 0 {
+		parts := []string{}
+
+		for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+			parts = append(parts, fmt.Sprintf("%s: %s", field, e.Fields[field]))
+		}
+
+		return fmt.Sprintf("greenlight: %d %s", e.StatusCode, strings.Join(parts, "; "))
+	}
+
+	return fmt.Sprintf("greenlight: %d %s", e.StatusCode, e.Message)
+}
+
+// Is matches the error against the Err variables by status code.
+func (e *Error) Is(target error) bool {
+	if target == ErrServer {
+		return e.StatusCode >= 500
+	}
+
+	return statusErrors[e.StatusCode] == target
+}
+
+// newError reads the {"error": ...} envelope of an error response.
+func newError(res *http.Response) error {
+	apiErr := &Error{StatusCode: res.StatusCode, RequestID: res.Header.Get("X-Request-ID")}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+
+	if err != nil {
+		return err
+	}
+
+	apiErr.Body = body
+
+	var env struct {
+		Error json.RawMessage `json:"error"`
+	}
+
+	if json.Unmarshal(body, &env) != nil || env.Error == nil {
+		apiErr.Message = http.StatusText(res.StatusCode)
+		return apiErr
+	}
+
+	if json.Unmarshal(env.Error, &apiErr.Message) == nil {
+		return apiErr
+	}
+
+	if json.Unmarshal(env.Error, &apiErr.Fields) != nil {
+		apiErr.Message = string(env.Error)
+	}
+
+	return apiErr
+}
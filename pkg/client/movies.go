@@ -0,0 +1,293 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MoviesService calls the movie endpoints. Reads need the movies:read permission
+// and writes the movies:write permission.
+type MoviesService struct {
+	client *Client
+}
+
+// ListMoviesParams are the search criteria and paging of a movie listing. Zero
+// values are left out of the request.
+type ListMoviesParams struct {
+	Title string
+	// Lang is the text search configuration for Title, like "english".
+	Lang          string
+	Genres        []string
+	GenresAny     []string
+	ExcludeGenres []string
+	YearMin       int
+	YearMax       int
+	RuntimeMin    int
+	RuntimeMax    int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	Page     int
+	PageSize int
+	// Sort keys, like "-year" or "title", or "relevance" when searching by title.
+	Sort []string
+
+	// Fields limits the movie fields in the response, and Include adds related
+	// data, like "genres", to them.
+	Fields  []string
+	Include []string
+
+	// Facets to count over every matching movie: "genres", "years" or "runtime".
+	Facets            []string
+	FacetYearInterval string
+}
+
+func (p ListMoviesParams) values() url.Values {
+	qs := url.Values{}
+
+	set := func(key, value string) {
+		if value != "" {
+			qs.Set(key, value)
+		}
+	}
+
+	setInt := func(key string, value int) {
+		if value != 0 {
+			qs.Set(key, strconv.Itoa(value))
+		}
+	}
+
+	setTime := func(key string, value time.Time) {
+		if !value.IsZero() {
+			qs.Set(key, value.Format(time.RFC3339))
+		}
+	}
+
+	genres := append([]string{}, p.Genres...)
+
+	for _, genre := range p.ExcludeGenres {
+		genres = append(genres, "-"+genre)
+	}
+
+	set("title", p.Title)
+	set("lang", p.Lang)
+	set("genres", joinList(genres))
+	set("genres_any", joinList(p.GenresAny))
+	setInt("year_min", p.YearMin)
+	setInt("year_max", p.YearMax)
+	setInt("runtime_min", p.RuntimeMin)
+	setInt("runtime_max", p.RuntimeMax)
+	setTime("created_after", p.CreatedAfter)
+	setTime("created_before", p.CreatedBefore)
+	setInt("page", p.Page)
+	setInt("page_size", p.PageSize)
+	set("sort", joinList(p.Sort))
+	set("fields", joinList(p.Fields))
+	set("include", joinList(p.Include))
+	set("facets", joinList(p.Facets))
+	set("facet_year_interval", p.FacetYearInterval)
+
+	return qs
+}
+
+// MoviePage is one page of a movie listing.
+type MoviePage struct {
+	Movies   []*Movie `json:"movies"`
+	Metadata Metadata `json:"metadata"`
+	// Facets is only set when facets were asked for.
+	Facets *Facets `json:"facets"`
+}
+
+// List returns one page of the movies matching params.
+func (s *MoviesService) List(ctx context.Context, params ListMoviesParams) (*MoviePage, error) {
+	page := &MoviePage{}
+
+	err := s.client.do(ctx, request{method: http.MethodGet, path: "/movies", query: params.values(), auth: true}, page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// All iterates over every movie matching params, fetching the pages one after the
+// other from params.Page on. Iteration stops at the first error, which is yielded
+// with a nil movie.
+func (s *MoviesService) All(ctx context.Context, params ListMoviesParams) iter.Seq2[*Movie, error] {
+	return func(yield func(*Movie, error) bool) {
+		params.Page = max(params.Page, 1)
+
+		for {
+			page, err := s.List(ctx, params)
+
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for _, movie := range page.Movies {
+				if !yield(movie, nil) {
+					return
+				}
+			}
+
+			if len(page.Movies) == 0 || params.Page >= page.Metadata.LastPage {
+				return
+			}
+
+			params.Page++
+		}
+	}
+}
+
+// Get returns the movie with the given id, and its entity tag for conditional
+// updates and deletes.
+func (s *MoviesService) Get(ctx context.Context, id int) (*Movie, string, error) {
+	return s.doMovie(ctx, request{method: http.MethodGet, path: fmt.Sprintf("/movies/%d", id), auth: true})
+}
+
+type CreateMovieInput struct {
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+}
+
+// Create adds a movie and returns it with its entity tag. Retries are deduplicated
+// with an Idempotency-Key, so a movie is never created twice.
+func (s *MoviesService) Create(ctx context.Context, input CreateMovieInput) (*Movie, string, error) {
+	return s.doMovie(ctx, request{method: http.MethodPost, path: "/movies", body: input, auth: true, idempotent: true})
+}
+
+// UpdateMovieInput holds the fields to change. Nil fields are left alone.
+type UpdateMovieInput struct {
+	Title   *string  `json:"title,omitempty"`
+	Year    *int32   `json:"year,omitempty"`
+	Runtime *Runtime `json:"runtime,omitempty"`
+	Genres  []string `json:"genres,omitempty"`
+
+	// IfMatch, when set, makes the update fail with ErrPreconditionFailed if the
+	// movie changed since it was read. Use the entity tag Get, Create or Update
+	// returned.
+	IfMatch string `json:"-"`
+}
+
+// Update changes the movie with the given id and returns it as updated, with its
+// new entity tag.
+func (s *MoviesService) Update(ctx context.Context, id int, input UpdateMovieInput) (*Movie, string, error) {
+	header := http.Header{}
+
+	if input.IfMatch != "" {
+		header.Set("If-Match", input.IfMatch)
+	}
+
+	return s.doMovie(ctx, request{method: http.MethodPatch, path: fmt.Sprintf("/movies/%d", id), body: input, header: header, auth: true})
+}
+
+// doMovie sends a request that responds with a movie, and returns the movie along
+// with the ETag header of the response.
+func (s *MoviesService) doMovie(ctx context.Context, req request) (*Movie, string, error) {
+	var env struct {
+		Movie *Movie `json:"movies"`
+	}
+
+	var header http.Header
+
+	req.responseHeader = &header
+
+	err := s.client.do(ctx, req, &env)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return env.Movie, header.Get("ETag"), nil
+}
+
+// Delete removes the movie with the given id. A non-empty ifMatch makes the delete
+// fail with ErrPreconditionFailed if the movie changed since it was read.
+func (s *MoviesService) Delete(ctx context.Context, id int, ifMatch string) error {
+	header := http.Header{}
+
+	if ifMatch != "" {
+		header.Set("If-Match", ifMatch)
+	}
+
+	return s.client.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/movies/%d", id), header: header, auth: true}, nil)
+}
+
+// Bulk operation types.
+const (
+	BulkAddGenre    = "add_genre"
+	BulkRemoveGenre = "remove_genre"
+	BulkDelete      = "delete"
+	BulkSetField    = "set_field"
+)
+
+type BulkOperation struct {
+	Type  string `json:"type"`
+	Genre string `json:"genre,omitempty"`
+	Field string `json:"field,omitempty"`
+	// Value is the new value of Field for set_field: a string for title, an
+	// integer for year and a Runtime for runtime.
+	Value any `json:"value,omitempty"`
+}
+
+// BulkInput selects movies either by IDs or by Filter, which takes the query
+// parameters of a listing, like {"genres": "drama"}.
+type BulkInput struct {
+	IDs       []int             `json:"ids,omitempty"`
+	Filter    map[string]string `json:"filter,omitempty"`
+	Operation BulkOperation     `json:"operation"`
+	// Preview reports what would change without changing anything.
+	Preview bool `json:"preview"`
+}
+
+type BulkResponse struct {
+	Preview bool         `json:"preview"`
+	Count   int          `json:"count"`
+	Results []BulkResult `json:"results"`
+}
+
+// Bulk applies one operation to many movies at once, in a single transaction. When
+// the operation is invalid for some of the movies nothing changes, and the error
+// is an *Error with Results telling which movies failed.
+func (s *MoviesService) Bulk(ctx context.Context, input BulkInput) (*BulkResponse, error) {
+	res := &BulkResponse{}
+
+	err := s.client.do(ctx, request{method: http.MethodPost, path: "/movies/bulk", body: input, auth: true, idempotent: true}, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// BulkResults returns the per-movie results of a bulk operation that was rejected
+// because it was invalid for some of the movies.
+func BulkResults(err error) ([]BulkResult, bool) {
+	var apiErr *Error
+
+	if !errors.As(err, &apiErr) {
+		return nil, false
+	}
+
+	var env struct {
+		Results []BulkResult `json:"results"`
+	}
+
+	if json.Unmarshal(apiErr.Body, &env) != nil || env.Results == nil {
+		return nil, false
+	}
+
+	return env.Results, true
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// PermissionsService calls the permission endpoints, which need the
+// admin:permissions permission.
+type PermissionsService struct {
+	client *Client
+}
+
+// List returns every permission the user with the given id has.
+func (s *PermissionsService) List(ctx context.Context, userID int64) ([]string, error) {
+	return s.do(ctx, request{method: http.MethodGet, path: fmt.Sprintf("/admin/users/%d/permissions", userID), auth: true})
+}
+
+// Grant gives the user the permissions, on top of those they already have, and
+// returns every permission the user has now.
+func (s *PermissionsService) Grant(ctx context.Context, userID int64, codes ...string) ([]string, error) {
+	body := map[string][]string{"permissions": codes}
+
+	return s.do(ctx, request{method: http.MethodPost, path: fmt.Sprintf("/admin/users/%d/permissions", userID), body: body, auth: true})
+}
+
+// Revoke takes the permission away from the user, if they have it, and returns
+// every permission the user has left.
+func (s *PermissionsService) Revoke(ctx context.Context, userID int64, code string) ([]string, error) {
+	return s.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/admin/users/%d/permissions/%s", userID, url.PathEscape(code)), auth: true})
+}
+
+func (s *PermissionsService) do(ctx context.Context, req request) ([]string, error) {
+	var env struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := s.client.do(ctx, req, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Permissions, nil
+}
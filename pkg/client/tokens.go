@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// TokensService calls the token endpoints.
+type TokensService struct {
+	client *Client
+}
+
+// Authenticate returns a new authentication token for the user. Clients created
+// with WithCredentials call it themselves when they need a token.
+func (s *TokensService) Authenticate(ctx context.Context, email, password string) (*Token, error) {
+	var env struct {
+		Token *Token `json:"authentication_token"`
+	}
+
+	body := map[string]string{"email": email, "password": password}
+
+	err := s.client.do(ctx, request{method: http.MethodPost, path: "/tokens/authentication", body: body}, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if env.Token == nil || env.Token.Plaintext == "" {
+		return nil, errNoToken
+	}
+
+	return env.Token, nil
+}
+
+// RequestActivation has a new activation token emailed to an inactive user.
+func (s *TokensService) RequestActivation(ctx context.Context, email string) error {
+	return s.client.do(ctx, request{method: http.MethodPost, path: "/tokens/activation", body: map[string]string{"email": email}}, nil)
+}
+
+// RequestPasswordReset has a password reset token emailed to the user.
+func (s *TokensService) RequestPasswordReset(ctx context.Context, email string) error {
+	return s.client.do(ctx, request{method: http.MethodPost, path: "/tokens/password-reset", body: map[string]string{"email": email}}, nil)
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"time"
+
+	"kyawzayarwin.com/greenlight/internal/data"
+)
+
+// Permissions a user can be granted. Endpoints that need one answer with
+// ErrForbidden when the user lacks it.
+const (
+	PermissionMovieRead        = data.PermissionMovieRead
+	PermissionMovieWrite       = data.PermissionMovieWrite
+	PermissionAdminDebug       = data.PermissionAdminDebug
+	PermissionAdminAudit       = data.PermissionAdminAudit
+	PermissionAdminPermissions = data.PermissionAdminPermissions
+)
+
+// Runtime is a movie runtime in minutes. Its JSON is a string like "102 mins".
+type Runtime = data.Runtime
+
+var ErrInvalidRuntimeFormat = data.ErrInvalidRuntimeFormat
+
+// Movie is the API's movie. Highlight is the title as escaped HTML with the search
+// matches wrapped in <mark> tags, when listing movies by title.
+type Movie = data.Movie
+
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+	Version   int       `json:"version"`
+}
+
+type Token struct {
+	Plaintext string    `json:"token"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// Metadata describes the page of a listing.
+type Metadata struct {
+	CurrentPage  int `json:"current_page"`
+	PageSize     int `json:"page_size"`
+	FirstPage    int `json:"first_page"`
+	LastPage     int `json:"last_page"`
+	TotalRecords int `json:"total_records"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets count the movies of a listing by genre, year and runtime range.
+type Facets struct {
+	Genres  []FacetCount `json:"genres,omitempty"`
+	Years   []FacetCount `json:"years,omitempty"`
+	Runtime []FacetCount `json:"runtime,omitempty"`
+}
+
+// BulkResult is what a bulk operation did, or would do, to one movie.
+type BulkResult struct {
+	ID     int               `json:"id"`
+	Status string            `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// UsersService calls the user endpoints, which don't need authentication.
+type UsersService struct {
+	client *Client
+}
+
+// Register creates an inactive user. The API emails them a token to Activate the
+// account with.
+func (s *UsersService) Register(ctx context.Context, name, email, password string) (*User, error) {
+	var env struct {
+		User *User `json:"users"`
+	}
+
+	body := map[string]string{"name": name, "email": email, "password": password}
+
+	err := s.client.do(ctx, request{method: http.MethodPost, path: "/users", body: body, idempotent: true}, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return env.User, nil
+}
+
+// Activate activates the user the activation token was sent to.
+func (s *UsersService) Activate(ctx context.Context, token string) (*User, error) {
+	var env struct {
+		User *User `json:"user"`
+	}
+
+	err := s.client.do(ctx, request{method: http.MethodPut, path: "/users/activated", body: map[string]string{"token": token}}, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return env.User, nil
+}
+
+// ResetPassword sets a new password with a password reset token.
+func (s *UsersService) ResetPassword(ctx context.Context, token, password string) error {
+	body := map[string]string{"token": token, "password": password}
+
+	return s.client.do(ctx, request{method: http.MethodPut, path: "/users/password", body: body}, nil)
+}